@@ -0,0 +1,27 @@
+// This file implements subcommand 'agent'.
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// doCmdAgent executes subcommand 'agent', serving the DB to other cmdsafe
+// processes until interrupted or, if idle is non-zero, unused for that long.
+// See vault.Vault.ServeAgent.
+func doCmdAgent(idle time.Duration) error {
+	interruptCh := make(chan os.Signal, 1)
+	signal.Notify(interruptCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interruptCh)
+
+	stop := make(chan struct{})
+	go func() {
+		if _, ok := <-interruptCh; ok {
+			close(stop)
+		}
+	}()
+	return safe.ServeAgent(idle, stop)
+}
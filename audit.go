@@ -0,0 +1,54 @@
+// This file implements subcommand 'audit'.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aleist/cmdsafe/vault"
+)
+
+// doCmdAudit executes subcommand 'audit', printing all audit records and
+// verifying the integrity of the hash chain.
+func doCmdAudit() error {
+	// Check if the DB exists.
+	if _, err := os.Stat(dbPath); err != nil {
+		return fmt.Errorf("cannot read database: %v", err)
+	}
+
+	if err := safe.AuditLog(printAuditRecord); err != nil {
+		return err
+	}
+	fmt.Println("Audit log verified.")
+	return nil
+}
+
+// printAuditRecord prints record with sequence number seq to stdout.
+func printAuditRecord(seq uint64, record *vault.AuditRecord) {
+	fmt.Printf("%d\t%s\t%s\t%s\t%s@%s\tstatus=%d\t%v",
+		seq, time.Unix(0, record.Time).Format(time.RFC3339), record.Subcommand,
+		record.Handle, record.User, record.Hostname, record.Status,
+		time.Duration(record.Duration))
+	if record.Error != "" {
+		fmt.Printf("\t%s", strconv.Quote(record.Error))
+	}
+	if record.Reason != "" {
+		fmt.Printf("\treason=%s", strconv.Quote(record.Reason))
+	}
+	fmt.Println()
+}
+
+// recordAudit appends a record of subcommand subcmd having been executed on
+// handle to the audit log, see vault.Vault.RecordAudit.
+func recordAudit(subcmd command, handle string, start time.Time, status int, err error) {
+	safe.RecordAudit(string(subcmd), handle, start, status, err)
+}
+
+// recordAuditReason is recordAudit for a subcommand given a reason, see
+// vault.Vault.RecordAuditReason.
+func recordAuditReason(subcmd command, handle, reason string, start time.Time, status int, err error) {
+	safe.RecordAuditReason(string(subcmd), handle, reason, start, status, err)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aleist/cmdsafe/vault"
+)
+
+func TestDeleteAudit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cmdsafe-delete")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	passwords := vault.PasswordFunc(func(req *vault.PasswordRequest) ([]byte, error) {
+		return []byte("password"), nil
+	})
+	safe, err = vault.Open(filepath.Join(dir, "vault.db"), passwords, &vault.Options{Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { safe = nil }()
+
+	for _, handle := range []string{"server1", "server2"} {
+		if err := safe.Save(&vault.Command{Name: handle, Executable: "ssh"}, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := deleteCommandEntry("server1", false); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := deleteCommandEntry("server2", true); err != nil {
+		t.Fatalf("delete -purge: %v", err)
+	}
+
+	var ops []string
+	err = safe.AuditLog(func(seq uint64, record *vault.AuditRecord) {
+		ops = append(ops, record.Subcommand+" "+record.Handle)
+	})
+	if err != nil {
+		t.Fatalf("AuditLog: %v", err)
+	}
+	if len(ops) != 2 || ops[0] != "delete server1" || ops[1] != "purge server2" {
+		t.Errorf("the audit log records %q, want a delete of server1 and a purge of server2", ops)
+	}
+}
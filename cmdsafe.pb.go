@@ -1,79 +0,0 @@
-// Code generated by protoc-gen-go.
-// source: cmdsafe.proto
-// DO NOT EDIT!
-
-/*
-Package main is a generated protocol buffer package.
-
-It is generated from these files:
-	cmdsafe.proto
-
-It has these top-level messages:
-	Command
-*/
-package main
-
-import proto "github.com/golang/protobuf/proto"
-import fmt "fmt"
-import math "math"
-
-// Reference imports to suppress errors if they are not otherwise used.
-var _ = proto.Marshal
-var _ = fmt.Errorf
-var _ = math.Inf
-
-// This is a compile-time assertion to ensure that this generated file
-// is compatible with the proto package it is being compiled against.
-// A compilation error at this line likely means your copy of the
-// proto package needs to be updated.
-const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
-
-type Command struct {
-	Name       string   `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
-	Executable string   `protobuf:"bytes,2,opt,name=executable" json:"executable,omitempty"`
-	Args       []string `protobuf:"bytes,3,rep,name=args" json:"args,omitempty"`
-}
-
-func (m *Command) Reset()                    { *m = Command{} }
-func (m *Command) String() string            { return proto.CompactTextString(m) }
-func (*Command) ProtoMessage()               {}
-func (*Command) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
-
-func (m *Command) GetName() string {
-	if m != nil {
-		return m.Name
-	}
-	return ""
-}
-
-func (m *Command) GetExecutable() string {
-	if m != nil {
-		return m.Executable
-	}
-	return ""
-}
-
-func (m *Command) GetArgs() []string {
-	if m != nil {
-		return m.Args
-	}
-	return nil
-}
-
-func init() {
-	proto.RegisterType((*Command)(nil), "cmdsafe.Command")
-}
-
-func init() { proto.RegisterFile("cmdsafe.proto", fileDescriptor0) }
-
-var fileDescriptor0 = []byte{
-	// 117 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xe2, 0xe2, 0x4d, 0xce, 0x4d, 0x29,
-	0x4e, 0x4c, 0x4b, 0xd5, 0x2b, 0x28, 0xca, 0x2f, 0xc9, 0x17, 0x62, 0x87, 0x72, 0x95, 0x02, 0xb9,
-	0xd8, 0x9d, 0xf3, 0x73, 0x73, 0x13, 0xf3, 0x52, 0x84, 0x84, 0xb8, 0x58, 0xf2, 0x12, 0x73, 0x53,
-	0x25, 0x18, 0x15, 0x18, 0x35, 0x38, 0x83, 0xc0, 0x6c, 0x21, 0x39, 0x2e, 0xae, 0xd4, 0x8a, 0xd4,
-	0xe4, 0xd2, 0x92, 0xc4, 0xa4, 0x9c, 0x54, 0x09, 0x26, 0xb0, 0x0c, 0x92, 0x08, 0x48, 0x4f, 0x62,
-	0x51, 0x7a, 0xb1, 0x04, 0xb3, 0x02, 0x33, 0x48, 0x0f, 0x88, 0xed, 0xc4, 0x16, 0xc5, 0x92, 0x9b,
-	0x98, 0x99, 0x97, 0xc4, 0x06, 0xb6, 0xca, 0x18, 0x10, 0x00, 0x00, 0xff, 0xff, 0x49, 0x90, 0xa2,
-	0x4f, 0x7b, 0x00, 0x00, 0x00,
-}
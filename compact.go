@@ -0,0 +1,33 @@
+// This file implements subcommand 'compact'.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aleist/cmdsafe/vault"
+)
+
+// doCmdCompact executes subcommand 'compact', rewriting the DB into a fresh
+// file and, if secure is set, overwriting the old one, see
+// vault.Vault.Compact.
+func doCmdCompact(secure bool) (err error) {
+	start := time.Now()
+	defer func() { recordAudit(compactCommand, "", start, 0, err) }()
+
+	return safe.Compact(secure)
+}
+
+// autoCompact runs subcommand 'compact -secure' after commands were removed
+// permanently, if enabled in the user configuration and the DB is a bolt
+// store.
+func autoCompact() error {
+	if !userCfg.AutoCompact || safe.Backend() != vault.BoltBackend {
+		return nil
+	}
+	if err := doCmdCompact(true); err != nil {
+		return fmt.Errorf("failed to compact the database: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,393 @@
+// This file implements the user configuration file and subcommand 'config'.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/aleist/cmdsafe/vault"
+)
+
+// configFileName is the name of the user configuration file in
+// $XDG_CONFIG_HOME/cmdsafe.
+const configFileName = "config.toml"
+
+// Actions of subcommand 'run' for expired commands.
+const (
+	warnExpired   = "warn"
+	refuseExpired = "refuse"
+)
+
+// Output formats.
+const (
+	textOutput = "text"
+	jsonOutput = "json"
+)
+
+// userConfig holds the settings from the user configuration file. Zero values
+// select the built-in defaults. Command line flags take precedence.
+type userConfig struct {
+	DB             string            `toml:"db,omitempty"`              // The DB path, see resolveDBPath.
+	Backend        string            `toml:"backend,omitempty"`         // The storage backend of a new DB.
+	KDF            *scryptParams     `toml:"kdf,omitempty"`             // The key derivation for new entries.
+	RunTimeout     duration          `toml:"run_timeout,omitzero"`      // The time limit for 'run'.
+	PasswordSource string            `toml:"password_source,omitempty"` // See requestPassword.
+	LockTimeout    duration          `toml:"lock_timeout,omitzero"`     // The time to wait for the DB lock.
+	AgentTimeout   duration          `toml:"agent_timeout,omitzero"`    // The idle time after which 'agent' exits.
+	HistoryLimit   int               `toml:"history_limit,omitzero"`    // The revisions kept per command, see vault.Options.
+	AutoCompact    bool              `toml:"auto_compact,omitempty"`    // Whether to run 'compact -secure' after removals.
+	RunExpired     string            `toml:"run_expired,omitempty"`     // Either "warn" or "refuse".
+	OutputFormat   string            `toml:"output_format,omitempty"`   // Either "text" or "json".
+	Aliases        map[string]string `toml:"aliases,omitempty"`         // Subcommand aliases.
+}
+
+// scryptParams are the scrypt cost parameters, see crypto.NewScryptKey.
+type scryptParams struct {
+	N int64 `toml:"n,omitzero"`
+	R int32 `toml:"r,omitzero"`
+	P int32 `toml:"p,omitzero"`
+}
+
+// duration is a time.Duration stored in its string form, e.g. "1m30s".
+type duration time.Duration
+
+// MarshalText implements encoding.TextMarshaler.
+func (d duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (d *duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	*d = duration(v)
+	return err
+}
+
+// userCfg is the loaded user configuration.
+var userCfg userConfig
+
+// configPath returns the path of the user configuration file. XDG_CONFIG_HOME
+// defaults to $HOME/.config.
+func configPath() (string, error) {
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot determine the config file path: %v", err)
+		}
+		configHome = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configHome, "cmdsafe", configFileName), nil
+}
+
+// userCfgErr is the error loading the user configuration file, if any. The
+// defaults are used instead, and the file is not overwritten.
+var userCfgErr error
+
+// loadUserConfig reads the user configuration file into userCfg. A missing
+// file is not an error. userCfg is left unchanged if the file cannot be read.
+// Aliases named after a subcommand are dropped with a warning.
+func loadUserConfig() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	var cfg userConfig
+	if _, err := toml.DecodeFile(path, &cfg); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read the config file %s: %v", path, err)
+	}
+	for name := range cfg.Aliases {
+		if err := checkAliasName(name); err != nil {
+			log.Printf("Warning: ignoring an alias in the config file %s: %v", path, err)
+			delete(cfg.Aliases, name)
+		}
+	}
+	userCfg = cfg
+	return nil
+}
+
+// saveUserConfig writes userCfg to the user configuration file. Refuses to
+// overwrite a file that failed to load, which would lose its settings.
+func saveUserConfig() error {
+	if userCfgErr != nil {
+		return fmt.Errorf("%v, fix or remove it first", userCfgErr)
+	}
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(userCfg); err != nil {
+		return fmt.Errorf("failed to serialise the config: %v", err)
+	}
+	return ioutil.WriteFile(path, buf.Bytes(), 0600)
+}
+
+// kdfParams returns the configured scrypt parameters for new entries, nil if
+// none are configured.
+func (c *userConfig) kdfParams() *vault.KDFParams {
+	if c.KDF == nil {
+		return nil
+	}
+	return &vault.KDFParams{N: c.KDF.N, R: c.KDF.R, P: c.KDF.P}
+}
+
+// validBackend returns whether name is a storage backend, see vault.Backends.
+func validBackend(name string) bool {
+	for _, backend := range vault.Backends() {
+		if name == backend {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAliasName returns an error if name is a subcommand, which an alias
+// would silently replace.
+func checkAliasName(name string) error {
+	for _, cmd := range commands {
+		if command(name) == cmd {
+			return fmt.Errorf("alias %q would replace subcommand %s", name, cmd)
+		}
+	}
+	return nil
+}
+
+// expandAlias replaces the subcommand in args with its alias definition, if
+// one is configured. The definition may contain flags for the subcommand.
+func (c *userConfig) expandAlias(args []string) []string {
+	def, ok := c.Aliases[args[0]]
+	if !ok {
+		return args
+	}
+	return append(strings.Fields(def), args[1:]...)
+}
+
+// printOutput prints v as JSON if the JSON output format is configured.
+// Otherwise it calls printText.
+func printOutput(v interface{}, printText func()) error {
+	if userCfg.OutputFormat != jsonOutput {
+		printText()
+		return nil
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// configKeys lists the keys accepted by subcommand 'config', in addition to
+// alias.<name>.
+var configKeys = []string{"db", "backend", "kdf.n", "kdf.r", "kdf.p", "run_timeout",
+	"password_source", "lock_timeout", "agent_timeout", "history_limit", "auto_compact", "run_expired", "output_format"}
+
+// doCmdConfig executes subcommand 'config'. With action "get", it prints the
+// value of key, or all set keys if key is empty. With action "set", it sets
+// key to value, an empty value resets key to its default.
+func doCmdConfig(action, key, value string) error {
+	if action == "get" {
+		return printConfig(key)
+	}
+
+	if err := setConfig(key, value); err != nil {
+		return err
+	}
+	return saveUserConfig()
+}
+
+// printConfig prints the value of key, or all set keys if key is empty.
+func printConfig(key string) error {
+	if key != "" {
+		value, err := getConfig(key)
+		if err != nil {
+			return err
+		}
+		fmt.Println(value)
+		return nil
+	}
+
+	keys := append([]string(nil), configKeys...)
+	var aliases []string
+	for name := range userCfg.Aliases {
+		aliases = append(aliases, "alias."+name)
+	}
+	sort.Strings(aliases)
+	for _, k := range append(keys, aliases...) {
+		if v, _ := getConfig(k); v != "" {
+			fmt.Printf("%s = %s\n", k, v)
+		}
+	}
+	return nil
+}
+
+// getConfig returns the configured value of key, or an empty string if it is
+// not set.
+func getConfig(key string) (string, error) {
+	itoa := func(v int64) string {
+		if v == 0 {
+			return ""
+		}
+		return strconv.FormatInt(v, 10)
+	}
+	durationString := func(d duration) string {
+		if d == 0 {
+			return ""
+		}
+		return time.Duration(d).String()
+	}
+
+	kdf := userCfg.KDF
+	if kdf == nil {
+		kdf = &scryptParams{}
+	}
+
+	switch key {
+	case "db":
+		return userCfg.DB, nil
+	case "backend":
+		return userCfg.Backend, nil
+	case "kdf.n":
+		return itoa(kdf.N), nil
+	case "kdf.r":
+		return itoa(int64(kdf.R)), nil
+	case "kdf.p":
+		return itoa(int64(kdf.P)), nil
+	case "run_timeout":
+		return durationString(userCfg.RunTimeout), nil
+	case "password_source":
+		return userCfg.PasswordSource, nil
+	case "lock_timeout":
+		return durationString(userCfg.LockTimeout), nil
+	case "agent_timeout":
+		return durationString(userCfg.AgentTimeout), nil
+	case "history_limit":
+		return itoa(int64(userCfg.HistoryLimit)), nil
+	case "auto_compact":
+		if !userCfg.AutoCompact {
+			return "", nil
+		}
+		return strconv.FormatBool(userCfg.AutoCompact), nil
+	case "run_expired":
+		return userCfg.RunExpired, nil
+	case "output_format":
+		return userCfg.OutputFormat, nil
+	}
+	if strings.HasPrefix(key, "alias.") {
+		return userCfg.Aliases[strings.TrimPrefix(key, "alias.")], nil
+	}
+	return "", fmt.Errorf("unknown config key %q", key)
+}
+
+// setConfig validates value and sets key to it, an empty value resets key to
+// its default.
+func setConfig(key, value string) error {
+	parseDuration := func(d *duration) error {
+		if value == "" {
+			*d = 0
+			return nil
+		}
+		return d.UnmarshalText([]byte(value))
+	}
+	parseInt := func(bits int) (int64, error) {
+		if value == "" {
+			return 0, nil
+		}
+		return strconv.ParseInt(value, 10, bits)
+	}
+
+	if strings.HasPrefix(key, "kdf.") && userCfg.KDF == nil {
+		userCfg.KDF = &scryptParams{}
+	}
+
+	var err error
+	switch key {
+	case "db":
+		userCfg.DB = value
+	case "backend":
+		if value != "" && !validBackend(value) {
+			return fmt.Errorf("invalid backend %q, want one of %s", value, strings.Join(vault.Backends(), ", "))
+		}
+		userCfg.Backend = value
+	case "kdf.n":
+		userCfg.KDF.N, err = parseInt(64)
+	case "kdf.r":
+		var v int64
+		v, err = parseInt(32)
+		userCfg.KDF.R = int32(v)
+	case "kdf.p":
+		var v int64
+		v, err = parseInt(32)
+		userCfg.KDF.P = int32(v)
+	case "run_timeout":
+		err = parseDuration(&userCfg.RunTimeout)
+	case "password_source":
+		if value != "" && value != "tty" {
+			if kind := strings.SplitN(value, ":", 2)[0]; kind != "env" && kind != "file" && kind != "cmd" {
+				return fmt.Errorf("invalid password source %q, want tty, env:NAME, file:PATH or cmd:CMD", value)
+			}
+		}
+		userCfg.PasswordSource = value
+	case "lock_timeout":
+		err = parseDuration(&userCfg.LockTimeout)
+	case "agent_timeout":
+		err = parseDuration(&userCfg.AgentTimeout)
+	case "history_limit":
+		var v int64
+		v, err = parseInt(32)
+		userCfg.HistoryLimit = int(v)
+	case "auto_compact":
+		userCfg.AutoCompact = false
+		if value != "" {
+			userCfg.AutoCompact, err = strconv.ParseBool(value)
+		}
+	case "run_expired":
+		if value != "" && value != warnExpired && value != refuseExpired {
+			return fmt.Errorf("invalid value %q for run_expired, want %s or %s", value, warnExpired, refuseExpired)
+		}
+		userCfg.RunExpired = value
+	case "output_format":
+		if value != "" && value != textOutput && value != jsonOutput {
+			return fmt.Errorf("invalid output format %q, want %s or %s", value, textOutput, jsonOutput)
+		}
+		userCfg.OutputFormat = value
+	default:
+		name := strings.TrimPrefix(key, "alias.")
+		if name == key || name == "" {
+			return fmt.Errorf("unknown config key %q", key)
+		}
+		if value == "" {
+			delete(userCfg.Aliases, name)
+		} else {
+			if err := checkAliasName(name); err != nil {
+				return err
+			}
+			if userCfg.Aliases == nil {
+				userCfg.Aliases = map[string]string{}
+			}
+			userCfg.Aliases[name] = value
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %v", key, err)
+	}
+
+	if strings.HasPrefix(key, "kdf.") {
+		return userCfg.kdfParams().Validate()
+	}
+	return nil
+}
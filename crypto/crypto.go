@@ -111,7 +111,7 @@ func Encrypt(plaintext []byte, userKey Key, fn EncryptFn,
 	const cipherAlgo = CipherAlgo_AES256CTR
 
 	// Generate a random encryption key.
-	key := make([]byte, 32)
+	key := make([]byte, dataKeySize)
 	if _, err := rand.Read(key); err != nil {
 		return nil, fmt.Errorf("failed to generate random encryption key: %v", err)
 	}
@@ -190,6 +190,103 @@ func Decrypt(env *CryptoEnvelope, userKey Key, fn DecryptFn,
 	return plaintext, nil
 }
 
+// Validate checks that env is structurally valid and only uses supported
+// algorithms and parameters. It does not verify any HMAC, see Decrypt and Open.
+func (env *CryptoEnvelope) Validate() error {
+	if env.Algorithm != CipherAlgo_AES256CTR {
+		return fmt.Errorf("unsupported cipher algorithm")
+	}
+	if len(env.Hmac) != sha256.Size {
+		return fmt.Errorf("wrong HMAC length, want %d, got %d", sha256.Size, len(env.Hmac))
+	}
+	if len(env.Iv) != aes.BlockSize {
+		return fmt.Errorf("wrong IV length, want %d, got %d", aes.BlockSize, len(env.Iv))
+	}
+
+	if len(env.Recipients) == 0 {
+		// A legacy envelope with a single user key.
+		if err := validateUserKey(env.UserKey); err != nil {
+			return err
+		}
+		return validateWrappedKey(env.Key)
+	}
+
+	if env.UserKey != nil || len(env.Key) != 0 {
+		return fmt.Errorf("unexpected user key in an envelope with recipients")
+	}
+	for i, r := range env.Recipients {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("recipient %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+// validate checks that r is structurally valid, see CryptoEnvelope.Validate.
+func (r *Recipient) validate() error {
+	switch r.Type {
+	case RecipientType_PASSWORD:
+		if err := validateUserKey(r.UserKey); err != nil {
+			return err
+		}
+	case RecipientType_X25519:
+		if len(r.PublicKey) != 32 || len(r.EphemeralKey) != 32 {
+			return fmt.Errorf("wrong X25519 key length")
+		}
+	default:
+		return fmt.Errorf("unsupported recipient type")
+	}
+
+	if len(r.Hmac) != sha256.Size {
+		return fmt.Errorf("wrong HMAC length, want %d, got %d", sha256.Size, len(r.Hmac))
+	}
+	return validateWrappedKey(r.Key)
+}
+
+// validateUserKey checks the key derivation configuration of a password.
+func validateUserKey(userKey *UserKey) error {
+	if userKey == nil || userKey.Scrypt == nil {
+		return fmt.Errorf("missing user key configuration")
+	}
+	if userKey.Algorithm != KeyAlgo_SCRYPT {
+		return fmt.Errorf("unsupported key derivation algorithm")
+	}
+
+	s := userKey.Scrypt
+	if len(s.Salt) == 0 {
+		return fmt.Errorf("missing scrypt salt")
+	}
+	if err := ValidateScryptParams(s.N, s.R, s.P); err != nil {
+		return err
+	}
+
+	if len(userKey.Hash) != sha256.Size {
+		return fmt.Errorf("wrong user key hash length, want %d, got %d", sha256.Size, len(userKey.Hash))
+	}
+	return nil
+}
+
+// validateWrappedKey checks the length of an encrypted 32-byte data key, which
+// is prefixed with its IV, see Encrypt.
+func validateWrappedKey(key []byte) error {
+	if want := aes.BlockSize + dataKeySize; len(key) != want {
+		return fmt.Errorf("wrong encryption key length, want %d, got %d", want, len(key))
+	}
+	return nil
+}
+
+// ValidateScryptParams checks the scrypt cost parameters against the
+// constraints documented for golang.org/x/crypto/scrypt Key.
+func ValidateScryptParams(N int64, r, p int32) error {
+	if N <= 1 || N&(N-1) != 0 {
+		return fmt.Errorf("invalid scrypt parameter N=%d, must be a power of 2 greater than 1", N)
+	}
+	if r <= 0 || p <= 0 || uint64(r)*uint64(p) >= 1<<30 {
+		return fmt.Errorf("invalid scrypt parameters r=%d, p=%d", r, p)
+	}
+	return nil
+}
+
 // Sign writes all given data to signer and returns the final checksum.
 func Sign(signer hash.Hash, data ...[]byte) ([]byte, error) {
 	for _, d := range data {
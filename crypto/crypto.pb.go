@@ -11,6 +11,7 @@ It is generated from these files:
 It has these top-level messages:
 	UserKey
 	ScryptConfig
+	Recipient
 	CryptoEnvelope
 */
 package crypto
@@ -68,6 +69,28 @@ func (x CipherAlgo) String() string {
 }
 func (CipherAlgo) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
 
+// Supported ways of wrapping the data key for a recipient.
+type RecipientType int32
+
+const (
+	RecipientType_PASSWORD RecipientType = 0
+	RecipientType_X25519   RecipientType = 1
+)
+
+var RecipientType_name = map[int32]string{
+	0: "PASSWORD",
+	1: "X25519",
+}
+var RecipientType_value = map[string]int32{
+	"PASSWORD": 0,
+	"X25519":   1,
+}
+
+func (x RecipientType) String() string {
+	return proto.EnumName(RecipientType_name, int32(x))
+}
+func (RecipientType) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
 // The password key derivation configuration.
 type UserKey struct {
 	Hash      []byte        `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
@@ -141,19 +164,82 @@ func (m *ScryptConfig) GetP() int32 {
 	return 0
 }
 
+// A recipient of an envelope and the data key wrapped for it.
+type Recipient struct {
+	Type         RecipientType `protobuf:"varint,1,opt,name=type,enum=cmdsafe.RecipientType" json:"type,omitempty"`
+	UserKey      *UserKey      `protobuf:"bytes,2,opt,name=user_key,json=userKey" json:"user_key,omitempty"`
+	PublicKey    []byte        `protobuf:"bytes,3,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"`
+	EphemeralKey []byte        `protobuf:"bytes,4,opt,name=ephemeral_key,json=ephemeralKey,proto3" json:"ephemeral_key,omitempty"`
+	Key          []byte        `protobuf:"bytes,5,opt,name=key,proto3" json:"key,omitempty"`
+	Hmac         []byte        `protobuf:"bytes,6,opt,name=hmac,proto3" json:"hmac,omitempty"`
+}
+
+func (m *Recipient) Reset()                    { *m = Recipient{} }
+func (m *Recipient) String() string            { return proto.CompactTextString(m) }
+func (*Recipient) ProtoMessage()               {}
+func (*Recipient) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *Recipient) GetType() RecipientType {
+	if m != nil {
+		return m.Type
+	}
+	return RecipientType_PASSWORD
+}
+
+func (m *Recipient) GetUserKey() *UserKey {
+	if m != nil {
+		return m.UserKey
+	}
+	return nil
+}
+
+func (m *Recipient) GetPublicKey() []byte {
+	if m != nil {
+		return m.PublicKey
+	}
+	return nil
+}
+
+func (m *Recipient) GetEphemeralKey() []byte {
+	if m != nil {
+		return m.EphemeralKey
+	}
+	return nil
+}
+
+func (m *Recipient) GetKey() []byte {
+	if m != nil {
+		return m.Key
+	}
+	return nil
+}
+
+func (m *Recipient) GetHmac() []byte {
+	if m != nil {
+		return m.Hmac
+	}
+	return nil
+}
+
+// An envelope either has a single user_key (legacy) or a list of recipients.
+// In the latter case, the hmac only covers algorithm+iv+data and is keyed with
+// a key derived from the data key. The key field is unused.
 type CryptoEnvelope struct {
-	Hmac      []byte     `protobuf:"bytes,1,opt,name=hmac,proto3" json:"hmac,omitempty"`
-	Iv        []byte     `protobuf:"bytes,2,opt,name=iv,proto3" json:"iv,omitempty"`
-	Key       []byte     `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
-	Algorithm CipherAlgo `protobuf:"varint,4,opt,name=algorithm,enum=cmdsafe.CipherAlgo" json:"algorithm,omitempty"`
-	UserKey   *UserKey   `protobuf:"bytes,5,opt,name=user_key,json=userKey" json:"user_key,omitempty"`
-	Data      []byte     `protobuf:"bytes,6,opt,name=data,proto3" json:"data,omitempty"`
+	Hmac       []byte       `protobuf:"bytes,1,opt,name=hmac,proto3" json:"hmac,omitempty"`
+	Iv         []byte       `protobuf:"bytes,2,opt,name=iv,proto3" json:"iv,omitempty"`
+	Key        []byte       `protobuf:"bytes,3,opt,name=key,proto3" json:"key,omitempty"`
+	Algorithm  CipherAlgo   `protobuf:"varint,4,opt,name=algorithm,enum=cmdsafe.CipherAlgo" json:"algorithm,omitempty"`
+	UserKey    *UserKey     `protobuf:"bytes,5,opt,name=user_key,json=userKey" json:"user_key,omitempty"`
+	Data       []byte       `protobuf:"bytes,6,opt,name=data,proto3" json:"data,omitempty"`
+	Recipients []*Recipient `protobuf:"bytes,7,rep,name=recipients" json:"recipients,omitempty"`
+	Expires    int64        `protobuf:"varint,8,opt,name=expires" json:"expires,omitempty"`
+	Policy     []byte       `protobuf:"bytes,9,opt,name=policy,proto3" json:"policy,omitempty"`
 }
 
 func (m *CryptoEnvelope) Reset()                    { *m = CryptoEnvelope{} }
 func (m *CryptoEnvelope) String() string            { return proto.CompactTextString(m) }
 func (*CryptoEnvelope) ProtoMessage()               {}
-func (*CryptoEnvelope) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+func (*CryptoEnvelope) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
 
 func (m *CryptoEnvelope) GetHmac() []byte {
 	if m != nil {
@@ -197,37 +283,70 @@ func (m *CryptoEnvelope) GetData() []byte {
 	return nil
 }
 
+func (m *CryptoEnvelope) GetRecipients() []*Recipient {
+	if m != nil {
+		return m.Recipients
+	}
+	return nil
+}
+
+func (m *CryptoEnvelope) GetExpires() int64 {
+	if m != nil {
+		return m.Expires
+	}
+	return 0
+}
+
+func (m *CryptoEnvelope) GetPolicy() []byte {
+	if m != nil {
+		return m.Policy
+	}
+	return nil
+}
+
 func init() {
 	proto.RegisterType((*UserKey)(nil), "cmdsafe.UserKey")
 	proto.RegisterType((*ScryptConfig)(nil), "cmdsafe.ScryptConfig")
+	proto.RegisterType((*Recipient)(nil), "cmdsafe.Recipient")
 	proto.RegisterType((*CryptoEnvelope)(nil), "cmdsafe.CryptoEnvelope")
 	proto.RegisterEnum("cmdsafe.KeyAlgo", KeyAlgo_name, KeyAlgo_value)
 	proto.RegisterEnum("cmdsafe.CipherAlgo", CipherAlgo_name, CipherAlgo_value)
+	proto.RegisterEnum("cmdsafe.RecipientType", RecipientType_name, RecipientType_value)
 }
 
 func init() { proto.RegisterFile("crypto/crypto.proto", fileDescriptor0) }
 
 var fileDescriptor0 = []byte{
-	// 327 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x5c, 0x91, 0x4f, 0x4b, 0xc3, 0x40,
-	0x10, 0xc5, 0xbb, 0xfd, 0x93, 0xb4, 0x63, 0x2c, 0x61, 0x4b, 0x21, 0xe0, 0xa5, 0xf4, 0x54, 0x2a,
-	0x46, 0xac, 0xe8, 0xbd, 0x86, 0x9e, 0xea, 0x41, 0xb6, 0xf5, 0xa0, 0x17, 0x59, 0xd3, 0x6d, 0x13,
-	0x4c, 0xb2, 0x61, 0x93, 0x16, 0x02, 0x7e, 0x32, 0x3f, 0x9d, 0xec, 0x24, 0x26, 0xc5, 0x53, 0xde,
-	0x2c, 0x93, 0x37, 0xf3, 0x7b, 0x03, 0x23, 0x5f, 0x15, 0x69, 0x2e, 0x6f, 0xcb, 0x8f, 0x9b, 0x2a,
-	0x99, 0x4b, 0x6a, 0xfa, 0xf1, 0x2e, 0xe3, 0x7b, 0x31, 0xfd, 0x06, 0xf3, 0x35, 0x13, 0x6a, 0x2d,
-	0x0a, 0x4a, 0xa1, 0x1b, 0xf0, 0x2c, 0x70, 0xc8, 0x84, 0xcc, 0x2c, 0x86, 0x9a, 0xba, 0x30, 0xe0,
-	0xd1, 0x41, 0xaa, 0x30, 0x0f, 0x62, 0xa7, 0x3d, 0x21, 0xb3, 0xe1, 0xc2, 0x76, 0xab, 0x7f, 0xdd,
-	0xb5, 0x28, 0x96, 0xd1, 0x41, 0xb2, 0xa6, 0x85, 0xde, 0x80, 0x91, 0xe1, 0x20, 0xa7, 0x33, 0x21,
-	0xb3, 0x8b, 0xc5, 0xb8, 0x6e, 0xde, 0xe0, 0xb3, 0x27, 0x93, 0x7d, 0x78, 0x60, 0x55, 0xd3, 0xf4,
-	0x19, 0xac, 0xf3, 0x77, 0xbd, 0x42, 0xc6, 0xa3, 0xfc, 0x6f, 0x05, 0xad, 0xa9, 0x05, 0x24, 0xc1,
-	0xd1, 0x1d, 0x46, 0x12, 0x5d, 0x29, 0xf4, 0xee, 0x31, 0xa2, 0x74, 0x95, 0x3a, 0xdd, 0xb2, 0x4a,
-	0xa7, 0x3f, 0x04, 0x86, 0x1e, 0x52, 0xae, 0x92, 0x93, 0x88, 0x64, 0x2a, 0x90, 0x29, 0xe6, 0x7e,
-	0xcd, 0x14, 0x73, 0x9f, 0x0e, 0xa1, 0x1d, 0x9e, 0xd0, 0xd1, 0x62, 0xed, 0xf0, 0x44, 0x6d, 0xe8,
-	0x7c, 0x89, 0x02, 0x4d, 0x2d, 0xa6, 0x25, 0xbd, 0x3b, 0xa7, 0xee, 0x22, 0xf5, 0xa8, 0x06, 0xf1,
-	0xc2, 0x34, 0x10, 0xea, 0x3f, 0xf8, 0x35, 0xf4, 0x8f, 0x99, 0x50, 0x1f, 0xda, 0xa9, 0x87, 0xe8,
-	0x4d, 0x4e, 0x55, 0xc0, 0xcc, 0x3c, 0x36, 0x49, 0xef, 0x78, 0xce, 0x1d, 0xa3, 0xdc, 0x4a, 0xeb,
-	0xf9, 0x18, 0xcc, 0x2a, 0x4f, 0x0a, 0x60, 0x6c, 0x3c, 0xf6, 0xf6, 0xb2, 0xb5, 0x5b, 0xf3, 0x2b,
-	0x80, 0x66, 0x20, 0xbd, 0x84, 0xc1, 0x72, 0xb5, 0x59, 0x3c, 0x3c, 0x7a, 0x5b, 0x66, 0xb7, 0x9e,
-	0xfa, 0xef, 0x46, 0x79, 0xd5, 0x4f, 0x03, 0xcf, 0x7a, 0xff, 0x1b, 0x00, 0x00, 0xff, 0xff, 0xdf,
-	0x00, 0xcc, 0x35, 0xed, 0x01, 0x00, 0x00,
+	// 482 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x84, 0x93, 0x5b, 0x8b, 0xd3, 0x40,
+	0x14, 0xc7, 0x77, 0x9a, 0x34, 0x69, 0x4f, 0xd3, 0x12, 0x66, 0xd9, 0x25, 0x20, 0x42, 0xa9, 0x2f,
+	0xb5, 0x62, 0x65, 0x23, 0x15, 0x7c, 0xac, 0x75, 0x9f, 0x56, 0x70, 0x99, 0x56, 0xbc, 0xbc, 0x48,
+	0x36, 0x3b, 0xdb, 0x0c, 0xe6, 0x32, 0x4c, 0xd2, 0x62, 0xc0, 0x0f, 0xe3, 0x27, 0xf2, 0x33, 0xc9,
+	0x9c, 0x5c, 0x1a, 0xf5, 0xc1, 0xa7, 0x9c, 0x73, 0xe6, 0x97, 0x73, 0xf9, 0x9f, 0x19, 0x38, 0x0f,
+	0x55, 0x29, 0x8b, 0xec, 0x45, 0xf5, 0x59, 0x4a, 0x95, 0x15, 0x19, 0xb5, 0xc3, 0xe4, 0x3e, 0x0f,
+	0x1e, 0xf8, 0xec, 0x07, 0xd8, 0x1f, 0x72, 0xae, 0x6e, 0x78, 0x49, 0x29, 0x98, 0x51, 0x90, 0x47,
+	0x1e, 0x99, 0x92, 0xb9, 0xc3, 0xd0, 0xa6, 0x4b, 0x18, 0x06, 0xf1, 0x3e, 0x53, 0xa2, 0x88, 0x12,
+	0xaf, 0x37, 0x25, 0xf3, 0x89, 0xef, 0x2e, 0xeb, 0x7f, 0x97, 0x37, 0xbc, 0x5c, 0xc7, 0xfb, 0x8c,
+	0x9d, 0x10, 0xfa, 0x1c, 0xac, 0x1c, 0x0b, 0x79, 0xc6, 0x94, 0xcc, 0x47, 0xfe, 0x45, 0x0b, 0x6f,
+	0x31, 0xbc, 0xc9, 0xd2, 0x07, 0xb1, 0x67, 0x35, 0x34, 0x7b, 0x07, 0x4e, 0x37, 0xae, 0x5b, 0xc8,
+	0x83, 0xb8, 0x68, 0x5a, 0xd0, 0x36, 0x75, 0x80, 0xa4, 0x58, 0xda, 0x60, 0x24, 0xd5, 0x9e, 0xc2,
+	0xdc, 0x7d, 0x46, 0x94, 0xf6, 0xa4, 0x67, 0x56, 0x9e, 0x9c, 0xfd, 0x22, 0x30, 0x64, 0x3c, 0x14,
+	0x52, 0xf0, 0xb4, 0xa0, 0x0b, 0x30, 0x8b, 0x52, 0x72, 0xcc, 0x35, 0xf1, 0x2f, 0xdb, 0x46, 0x5a,
+	0x62, 0x57, 0x4a, 0xce, 0x90, 0xa1, 0xcf, 0x60, 0x70, 0xc8, 0xb9, 0xfa, 0xfa, 0x8d, 0x97, 0x58,
+	0x6a, 0xd4, 0x99, 0xb2, 0x96, 0x87, 0xd9, 0x87, 0xca, 0xa0, 0x8f, 0x01, 0xe4, 0xe1, 0x2e, 0x16,
+	0x21, 0xe2, 0x06, 0xb6, 0x3a, 0xac, 0x22, 0xfa, 0xf8, 0x09, 0x8c, 0xb9, 0x8c, 0x78, 0xc2, 0x55,
+	0x10, 0x23, 0x61, 0x22, 0xe1, 0xb4, 0x41, 0x0d, 0xb9, 0x60, 0xe8, 0xa3, 0x3e, 0x1e, 0x69, 0x13,
+	0xd5, 0x4f, 0x82, 0xd0, 0xb3, 0x6a, 0xf5, 0x93, 0x20, 0x9c, 0xfd, 0xec, 0xc1, 0x64, 0x83, 0x6b,
+	0xbb, 0x4e, 0x8f, 0x3c, 0xce, 0x24, 0x6f, 0x31, 0x72, 0xc2, 0xe8, 0x04, 0x7a, 0xe2, 0x88, 0x7d,
+	0x3b, 0xac, 0x27, 0x8e, 0x4d, 0x72, 0xe3, 0x94, 0xfc, 0xaa, 0xbb, 0x46, 0x13, 0x05, 0x39, 0x6f,
+	0x07, 0xdc, 0x08, 0x19, 0x71, 0xf5, 0xf7, 0x26, 0xbb, 0x92, 0xf4, 0xff, 0x27, 0x09, 0x05, 0xf3,
+	0x3e, 0x28, 0x82, 0xa6, 0x79, 0x6d, 0x53, 0x1f, 0x40, 0x35, 0x52, 0xe7, 0x9e, 0x3d, 0x35, 0xe6,
+	0x23, 0x9f, 0xfe, 0xbb, 0x05, 0xd6, 0xa1, 0xa8, 0x07, 0x36, 0xff, 0x2e, 0x85, 0xe2, 0xb9, 0x37,
+	0xc0, 0x8d, 0x37, 0x2e, 0xbd, 0x04, 0x4b, 0x66, 0xb1, 0x08, 0x4b, 0x6f, 0x88, 0x35, 0x6a, 0x6f,
+	0x71, 0x01, 0x76, 0x7d, 0x0d, 0x29, 0x80, 0xb5, 0xdd, 0xb0, 0xcf, 0xb7, 0x3b, 0xf7, 0x6c, 0xf1,
+	0x08, 0xe0, 0x34, 0x16, 0x1d, 0xc3, 0x70, 0x7d, 0xbd, 0xf5, 0x57, 0xaf, 0x36, 0x3b, 0xe6, 0x9e,
+	0x2d, 0x9e, 0xc2, 0xf8, 0x8f, 0x4b, 0x40, 0x1d, 0x18, 0xdc, 0xae, 0xb7, 0xdb, 0x8f, 0xef, 0xd9,
+	0x5b, 0xf7, 0x4c, 0xe7, 0xf9, 0xe4, 0xaf, 0x56, 0x57, 0xaf, 0x5d, 0xf2, 0x66, 0xf0, 0xc5, 0xaa,
+	0xde, 0xcd, 0x9d, 0x85, 0x0f, 0xe7, 0xe5, 0xef, 0x01, 0x00, 0x21, 0x37, 0xd2, 0xf0, 0x4f, 0x03,
+	0x00, 0x00,
 }
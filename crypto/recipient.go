@@ -0,0 +1,247 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// dataKeySize is the size of the random data encryption key in bytes.
+const dataKeySize = 32
+
+// publicKeyPrefix is the prefix of the string form of an X25519 public key.
+const publicKeyPrefix = "cmdsafe1"
+
+// Seal is a helper that uses function fn to encrypt plaintext with a random
+// data key for an envelope with recipients.
+//
+// The envelope is signed with an HMAC based on the hash from hashFn and a key
+// derived from the data key, see SignEnvelope. It has no recipients yet, the
+// returned data key must be wrapped for them with the New*Recipient functions.
+func Seal(plaintext []byte, fn EncryptFn, hashFn func() hash.Hash) (*CryptoEnvelope, []byte, error) {
+	// Generate a random encryption key.
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate random encryption key: %v", err)
+	}
+
+	// Encrypt the data.
+	iv, ciphertext, err := fn(dataKey, plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	env := &CryptoEnvelope{
+		Iv:        iv,
+		Algorithm: CipherAlgo_AES256CTR, // Currently the only supported algorithm.
+		Data:      ciphertext,
+	}
+	if err := SignEnvelope(env, dataKey, hashFn); err != nil {
+		return nil, nil, err
+	}
+	return env, dataKey, nil
+}
+
+// Open is a helper that verifies env.Hmac with dataKey, which must have been
+// unwrapped from one of env.Recipients, and uses function fn to decrypt
+// env.Data.
+func Open(env *CryptoEnvelope, dataKey []byte, fn DecryptFn, hashFn func() hash.Hash) ([]byte, error) {
+	if env.Algorithm != CipherAlgo_AES256CTR {
+		return nil, fmt.Errorf("unsupported cipher algorithm")
+	}
+
+	sig, err := envelopeHMAC(env, dataKey, hashFn)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(sig, env.Hmac) {
+		return nil, fmt.Errorf("invalid signature, the data may have been tempered with")
+	}
+
+	return fn(dataKey, env.Iv, env.Data)
+}
+
+// SignEnvelope sets env.Hmac for an envelope with recipients. The HMAC covers
+// the algorithm, IV and data and is keyed with a key derived from dataKey, so
+// that any recipient can verify it and recipients can be added or removed
+// without re-encrypting the data.
+func SignEnvelope(env *CryptoEnvelope, dataKey []byte, hashFn func() hash.Hash) error {
+	sig, err := envelopeHMAC(env, dataKey, hashFn)
+	if err != nil {
+		return err
+	}
+	env.Hmac = sig
+	return nil
+}
+
+// envelopeHMAC returns the HMAC of an envelope with recipients.
+func envelopeHMAC(env *CryptoEnvelope, dataKey []byte, hashFn func() hash.Hash) ([]byte, error) {
+	macKey, err := Sign(hmac.New(hashFn, dataKey), []byte("cmdsafe envelope hmac"))
+	if err != nil {
+		return nil, err
+	}
+	return Sign(hmac.New(hashFn, macKey),
+		[]byte(strconv.Itoa(int(env.Algorithm))), env.Iv, env.Data)
+}
+
+// UnwrapLegacy verifies the HMAC of an envelope with a single user key and
+// returns its data key decrypted with userKey and function fn. It is used to
+// convert such envelopes to the recipients form.
+func UnwrapLegacy(env *CryptoEnvelope, userKey Key, fn DecryptFn, hashFn func() hash.Hash) ([]byte, error) {
+	sig, err := Sign(hmac.New(hashFn, userKey.HMAC()),
+		[]byte(strconv.Itoa(int(env.Algorithm))), env.Iv, env.Key, env.Data)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(sig, env.Hmac) {
+		return nil, fmt.Errorf("invalid signature, the data may have been tempered with")
+	}
+	return unwrapKey(env.Key, userKey, fn)
+}
+
+// NewPasswordRecipient returns a recipient with dataKey wrapped by function fn
+// with userKey, which has been derived from a password with scryptConfig.
+func NewPasswordRecipient(dataKey []byte, userKey Key, scryptConfig *ScryptConfig,
+		fn EncryptFn, hashFn func() hash.Hash) (*Recipient, error) {
+
+	r := &Recipient{
+		Type: RecipientType_PASSWORD,
+		UserKey: &UserKey{
+			Algorithm: KeyAlgo_SCRYPT,
+			Hash:      userKey.Hash(),
+			Scrypt:    scryptConfig,
+		},
+	}
+	return r, r.wrap(dataKey, userKey, fn, hashFn)
+}
+
+// NewX25519Recipient returns a recipient with dataKey wrapped by function fn
+// with a key agreed between publicKey and a new ephemeral key pair.
+func NewX25519Recipient(dataKey, publicKey []byte, fn EncryptFn,
+		hashFn func() hash.Hash) (*Recipient, error) {
+
+	ephemeralKey, ephemeralPublicKey, err := GenerateX25519Key()
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recipient{
+		Type:         RecipientType_X25519,
+		PublicKey:    publicKey,
+		EphemeralKey: ephemeralPublicKey,
+	}
+	wrapKey, err := x25519WrapKey(ephemeralKey, publicKey, ephemeralPublicKey, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return r, r.wrap(dataKey, wrapKey, fn, hashFn)
+}
+
+// X25519WrapKey returns the key wrapping the data key of recipient r of type
+// X25519 for the holder of privateKey.
+func (r *Recipient) X25519WrapKey(privateKey []byte) (Key, error) {
+	return x25519WrapKey(privateKey, r.EphemeralKey, r.EphemeralKey, r.PublicKey)
+}
+
+// Unwrap verifies the HMAC of r with wrapKey and returns the data key it wraps,
+// decrypted with function fn.
+//
+// wrapKey is either the key derived from the password for type PASSWORD or the
+// result of X25519WrapKey for type X25519.
+func (r *Recipient) Unwrap(wrapKey Key, fn DecryptFn, hashFn func() hash.Hash) ([]byte, error) {
+	sig, err := Sign(hmac.New(hashFn, wrapKey.HMAC()), []byte(strconv.Itoa(int(r.Type))), r.Key)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(sig, r.Hmac) {
+		return nil, fmt.Errorf("invalid recipient signature, wrong key or the data may have been tempered with")
+	}
+	return unwrapKey(r.Key, wrapKey, fn)
+}
+
+// wrap sets r.Key to dataKey encrypted with wrapKey and function fn and signs
+// it with r.Hmac.
+func (r *Recipient) wrap(dataKey []byte, wrapKey Key, fn EncryptFn, hashFn func() hash.Hash) error {
+	keyIV, keyCipher, err := fn(wrapKey.Encryption(), dataKey)
+	if err != nil {
+		return err
+	}
+	r.Key = make([]byte, 0, len(keyIV)+len(keyCipher))
+	r.Key = append(r.Key, keyIV...)
+	r.Key = append(r.Key, keyCipher...)
+
+	r.Hmac, err = Sign(hmac.New(hashFn, wrapKey.HMAC()), []byte(strconv.Itoa(int(r.Type))), r.Key)
+	return err
+}
+
+// unwrapKey decrypts wrapped, a data key prefixed with its IV, with
+// wrapKey.Encryption and function fn.
+func unwrapKey(wrapped []byte, wrapKey Key, fn DecryptFn) ([]byte, error) {
+	const cipherBlockSize = 16 // AES, the only supported cipher.
+	if len(wrapped) < cipherBlockSize {
+		return nil, fmt.Errorf("wrapped key too short")
+	}
+	return fn(wrapKey.Encryption(), wrapped[:cipherBlockSize], wrapped[cipherBlockSize:])
+}
+
+// x25519WrapKey derives a 64-byte wrap Key from the X25519 agreement between
+// privateKey and publicKey, bound to both public keys of the exchange.
+func x25519WrapKey(privateKey, publicKey, ephemeralPublicKey, recipientPublicKey []byte) (Key, error) {
+	if len(privateKey) != 32 || len(publicKey) != 32 {
+		return nil, fmt.Errorf("invalid X25519 key length")
+	}
+
+	var shared, priv, pub [32]byte
+	copy(priv[:], privateKey)
+	copy(pub[:], publicKey)
+	curve25519.ScalarMult(&shared, &priv, &pub)
+	if shared == [32]byte{} {
+		return nil, fmt.Errorf("invalid X25519 public key")
+	}
+
+	salt := make([]byte, 0, 64)
+	salt = append(salt, ephemeralPublicKey...)
+	salt = append(salt, recipientPublicKey...)
+	key := make(Key, 64)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared[:], salt, []byte("cmdsafe x25519")), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// GenerateX25519Key returns a new random X25519 private key and its public key.
+func GenerateX25519Key() (privateKey, publicKey []byte, err error) {
+	var priv, pub [32]byte
+	if _, err := rand.Read(priv[:]); err != nil {
+		return nil, nil, fmt.Errorf("failed to generate random private key: %v", err)
+	}
+	curve25519.ScalarBaseMult(&pub, &priv)
+	return priv[:], pub[:], nil
+}
+
+// FormatPublicKey returns the string form of an X25519 public key.
+func FormatPublicKey(publicKey []byte) string {
+	return publicKeyPrefix + base64.RawURLEncoding.EncodeToString(publicKey)
+}
+
+// ParsePublicKey parses the string form of an X25519 public key, see
+// FormatPublicKey.
+func ParsePublicKey(s string) ([]byte, error) {
+	if !strings.HasPrefix(s, publicKeyPrefix) {
+		return nil, fmt.Errorf("invalid public key, missing prefix %s", publicKeyPrefix)
+	}
+	key, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(s, publicKeyPrefix))
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("invalid public key")
+	}
+	return key, nil
+}
@@ -0,0 +1,37 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"time"
+)
+
+// TOTP returns the time-based one-time password for secret at time t as
+// specified by RFC 6238, with the given time step period, number of digits and
+// an HMAC based on the hash from hashFn (e.g. sha1.New).
+func TOTP(secret []byte, t time.Time, period time.Duration, digits int,
+		hashFn func() hash.Hash) (string, error) {
+
+	if period < time.Second || digits < 6 || digits > 10 {
+		return "", fmt.Errorf("invalid TOTP parameters")
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(t.Unix()/int64(period/time.Second)))
+	sum, err := Sign(hmac.New(hashFn, secret), counter)
+	if err != nil {
+		return "", err
+	}
+
+	// Dynamic truncation, see RFC 4226 section 5.3.
+	offset := sum[len(sum)-1] & 0xf
+	code := uint64(binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff)
+
+	modulus := uint64(1)
+	for i := 0; i < digits; i++ {
+		modulus *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, code%modulus), nil
+}
@@ -0,0 +1,60 @@
+package crypto
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"testing"
+	"time"
+)
+
+// TestTOTPVectors checks TOTP against the test vectors of RFC 6238 Appendix B.
+func TestTOTPVectors(t *testing.T) {
+	seeds := []struct {
+		name   string
+		secret []byte
+		hashFn func() hash.Hash
+	}{
+		{"SHA1", []byte("12345678901234567890"), sha1.New},
+		{"SHA256", []byte("12345678901234567890123456789012"), sha256.New},
+		{"SHA512", []byte("1234567890123456789012345678901234567890123456789012345678901234"), sha512.New},
+	}
+	vectors := []struct {
+		unix  int64
+		codes [3]string // By seed.
+	}{
+		{59, [3]string{"94287082", "46119246", "90693936"}},
+		{1111111109, [3]string{"07081804", "68084774", "25091201"}},
+		{1111111111, [3]string{"14050471", "67062674", "99943326"}},
+		{1234567890, [3]string{"89005924", "91819424", "93441116"}},
+		{2000000000, [3]string{"69279037", "90698825", "38618901"}},
+		{20000000000, [3]string{"65353130", "77737706", "47863826"}},
+	}
+	for _, v := range vectors {
+		for i, seed := range seeds {
+			code, err := TOTP(seed.secret, time.Unix(v.unix, 0), 30*time.Second, 8, seed.hashFn)
+			if err != nil || code != v.codes[i] {
+				t.Errorf("TOTP(%s, %d) = %q, %v, want %q", seed.name, v.unix, code, err, v.codes[i])
+			}
+		}
+	}
+}
+
+func TestTOTPDigits(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	at := time.Unix(59, 0)
+
+	// Fewer digits keep the low-order ones, see RFC 4226 section 5.3.
+	if code, err := TOTP(secret, at, 30*time.Second, 6, sha1.New); err != nil || code != "287082" {
+		t.Errorf("TOTP with 6 digits = %q, %v, want %q", code, err, "287082")
+	}
+	for _, digits := range []int{5, 11} {
+		if _, err := TOTP(secret, at, 30*time.Second, digits, sha1.New); err == nil {
+			t.Errorf("TOTP with %d digits succeeded, want an error", digits)
+		}
+	}
+	if _, err := TOTP(secret, at, 500*time.Millisecond, 6, sha1.New); err == nil {
+		t.Errorf("TOTP with a sub-second period succeeded, want an error")
+	}
+}
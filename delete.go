@@ -1,28 +1,45 @@
-// This file implements subcommand 'delete'.
+// This file implements subcommands 'delete' and 'undelete'.
 
 package main
 
 import (
-	"fmt"
-
-	"github.com/boltdb/bolt"
+	"time"
 )
 
-// doCmdDelete executes subcommand 'delete', removing the key handle and its
-// associated data from the DB.
-func doCmdDelete(handle string) error {
-	return accessDB(false, func(db *bolt.DB) error {
-		if err := createBuckets(db); err != nil {
-			return err
-		}
-
-		return db.Update(func(tx *bolt.Tx) error {
-			cmdBucket := tx.Bucket([]byte(commandBucketName))
-			// Tell the user if the key is not found in case it was a typo.
-			if v := cmdBucket.Get([]byte(handle)); v == nil {
-				return fmt.Errorf("%s not found", handle)
-			}
-			return cmdBucket.Delete([]byte(handle))
-		})
-	})
+// purgeOp is recorded in the audit log for 'delete -purge', which unlike a
+// plain delete cannot be undone.
+const purgeOp command = "purge"
+
+// doCmdDelete executes subcommand 'delete', moving the key handle and its
+// associated data from the DB into the trash, or removing it together with
+// its trash and history entries if purge is set.
+func doCmdDelete(handle string, purge bool) error {
+	if err := deleteCommandEntry(handle, purge); err != nil || !purge {
+		return err
+	}
+	return autoCompact()
+}
+
+// deleteCommandEntry implements doCmdDelete up to compacting the DB.
+func deleteCommandEntry(handle string, purge bool) (err error) {
+	start := time.Now()
+	op := deleteCommand
+	if purge {
+		op = purgeOp
+	}
+	defer func() { recordAudit(op, handle, start, 0, err) }()
+
+	if purge {
+		return safe.Purge(handle)
+	}
+	return safe.Delete(handle)
+}
+
+// doCmdUndelete executes subcommand 'undelete', moving the key handle and its
+// associated data back out of the trash.
+func doCmdUndelete(handle string) (err error) {
+	start := time.Now()
+	defer func() { recordAudit(undeleteCommand, handle, start, 0, err) }()
+
+	return safe.Undelete(handle)
 }
@@ -0,0 +1,64 @@
+// This file implements subcommand 'fsck'.
+
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+type fsckOptions struct {
+	Password   bool // Verify HMACs and names of entries matching a password.
+	Quarantine bool // Move broken entries into the quarantine bucket.
+}
+
+// doCmdFsck executes subcommand 'fsck', checking the integrity of all stored
+// command entries and reporting broken and, for git stores, conflicting ones.
+// Broken entries are moved into the quarantine bucket if requested, see
+// vault.Vault.Check.
+func doCmdFsck(config *fsckOptions) error {
+	// Check if the DB exists.
+	if _, err := os.Stat(dbPath); err != nil {
+		return fmt.Errorf("cannot read database: %v", err)
+	}
+
+	report, err := safe.Check(config.Password)
+	if err != nil {
+		return err
+	}
+
+	var broken []string
+	for _, e := range report.Broken {
+		fmt.Println(e)
+		broken = append(broken, e.Handle)
+	}
+	for _, e := range report.Conflicts {
+		fmt.Println(e)
+	}
+	fmt.Printf("%d entries checked", report.Checked)
+	if config.Password {
+		fmt.Printf(", %d decrypted", len(report.Decrypted))
+	}
+	fmt.Printf(", %d broken", len(broken))
+	if len(report.Conflicts) > 0 {
+		fmt.Printf(", %d conflicting", len(report.Conflicts))
+	}
+	fmt.Println()
+
+	if len(broken) > 0 && config.Quarantine {
+		if err := safe.Quarantine(broken); err != nil {
+			return err
+		}
+		fmt.Printf("Moved %d broken entries to the quarantine bucket\n", len(broken))
+		broken = nil
+	}
+	switch {
+	case len(report.Conflicts) > 0:
+		// Conflicts cannot be quarantined, they are resolved in the repository.
+		return fmt.Errorf("found %d entries with conflicting edits, resolve them in the repository",
+			len(report.Conflicts))
+	case len(broken) > 0:
+		return fmt.Errorf("found %d broken entries", len(broken))
+	}
+	return nil
+}
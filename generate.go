@@ -0,0 +1,137 @@
+// This file implements the generation of random secrets for subcommand 'save'.
+
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aleist/cmdsafe/vault"
+)
+
+// charsets maps the names of the character sets for generated secrets to their
+// characters.
+var charsets = map[string]string{
+	"alnum":  "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789",
+	"alpha":  "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+	"lower":  "abcdefghijklmnopqrstuvwxyz",
+	"upper":  "ABCDEFGHIJKLMNOPQRSTUVWXYZ",
+	"digits": "0123456789",
+	"hex":    "0123456789abcdef",
+	"print":  "!\"#$%&'()*+,-./0123456789:;<=>?@ABCDEFGHIJKLMNOPQRSTUVWXYZ[\\]^_`abcdefghijklmnopqrstuvwxyz{|}~",
+}
+
+// defaultCharset is the character set of a generated secret if none is given.
+const defaultCharset = "alnum"
+
+// generatorNamePattern matches valid names of generated secrets.
+var generatorNamePattern = regexp.MustCompile(`^[\w-]+$`)
+
+// clipboardTools lists the commands tried in order to copy to the clipboard.
+var clipboardTools = [][]string{
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+	{"pbcopy"},
+}
+
+// secretGenerator describes a random secret generated on save, which replaces
+// the placeholder {{<name>}}.
+type secretGenerator struct {
+	Name    string
+	Length  int
+	Charset string // The name of the character set, see charsets.
+}
+
+// parseSecretGenerator parses spec of the form "name:length[:charset]".
+func parseSecretGenerator(spec string) (*secretGenerator, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("invalid generator %q, want name:length[:charset]", spec)
+	}
+
+	gen := &secretGenerator{Name: parts[0], Charset: defaultCharset}
+	if !generatorNamePattern.MatchString(gen.Name) || "{{"+gen.Name+"}}" == vault.TOTPPlaceholder {
+		return nil, fmt.Errorf("invalid generator name %q", gen.Name)
+	}
+	length, err := strconv.Atoi(parts[1])
+	if err != nil || length < 1 || length > 1024 {
+		return nil, fmt.Errorf("invalid generator length %q, want 1 to 1024", parts[1])
+	}
+	gen.Length = length
+	if len(parts) == 3 {
+		if _, ok := charsets[parts[2]]; !ok {
+			names := make([]string, 0, len(charsets))
+			for name := range charsets {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown charset %q, want one of %s", parts[2], strings.Join(names, ", "))
+		}
+		gen.Charset = parts[2]
+	}
+	return gen, nil
+}
+
+// generateSecrets generates the secrets described by generators and replaces
+// their placeholders in the arguments and environment values of cmdData,
+// marking the values as secret. Returns the secrets by name.
+func generateSecrets(cmdData *vault.Command, generators []*secretGenerator) (map[string]string, error) {
+	secrets := map[string]string{}
+	for _, gen := range generators {
+		placeholder := "{{" + gen.Name + "}}"
+		used := false
+		_ = cmdData.MapValues(func(value string) (string, error) {
+			used = used || strings.Contains(value, placeholder)
+			return value, nil
+		})
+		if !used {
+			return nil, fmt.Errorf("the placeholder %s is not used by the command", placeholder)
+		}
+
+		secret, err := randomString(gen.Length, charsets[gen.Charset])
+		if err != nil {
+			return nil, err
+		}
+		secrets[gen.Name] = secret
+		_ = cmdData.MapSecretValues(func(value string) (string, error) {
+			return strings.Replace(value, placeholder, secret, -1), nil
+		})
+	}
+	return secrets, nil
+}
+
+// randomString returns a string of length characters chosen uniformly at
+// random from charset.
+func randomString(length int, charset string) (string, error) {
+	max := big.NewInt(int64(len(charset)))
+	s := make([]byte, length)
+	for i := range s {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate a random secret: %v", err)
+		}
+		s[i] = charset[n.Int64()]
+	}
+	return string(s), nil
+}
+
+// copyToClipboard copies text to the clipboard with the first of the
+// clipboardTools installed.
+func copyToClipboard(text string) error {
+	for _, tool := range clipboardTools {
+		if _, err := exec.LookPath(tool[0]); err != nil {
+			continue
+		}
+		_, err := runExternalTool(tool[0], tool[1:], bytes.NewBufferString(text), nil)
+		return err
+	}
+	return fmt.Errorf("no clipboard tool found, install one of wl-copy, xclip, xsel or pbcopy")
+}
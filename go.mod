@@ -3,11 +3,11 @@ module github.com/aleist/cmdsafe
 go 1.12
 
 require (
-	github.com/boltdb/bolt v1.3.1
+	github.com/BurntSushi/toml v0.3.1
 	github.com/golang/protobuf v1.3.2
+	github.com/mattn/go-sqlite3 v1.11.0
+	github.com/tobischo/gokeepasslib/v3 v3.0.0
+	go.etcd.io/bbolt v1.3.3
 	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4
-	golang.org/x/net v0.0.0-20190813141303-74dc4d7220e7 // indirect
-	golang.org/x/sys v0.0.0-20190813064441-fde4db37ae7a // indirect
-	golang.org/x/text v0.3.2 // indirect
-	golang.org/x/tools v0.0.0-20190814235402-ea4142463bf3 // indirect
+	golang.org/x/sys v0.0.0-20190813064441-fde4db37ae7a
 )
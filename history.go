@@ -0,0 +1,59 @@
+// This file implements subcommands 'history' and 'restore'.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aleist/cmdsafe/vault"
+)
+
+// revisionOutput is the JSON form of a revision printed by subcommand
+// 'history'.
+type revisionOutput struct {
+	Rev     uint64    `json:"rev"`
+	Time    time.Time `json:"time"`
+	Deleted bool      `json:"deleted"`
+}
+
+// doCmdHistory executes subcommand 'history', printing the previous revisions
+// of the command stored under handle from the oldest to the latest, with the
+// time each was replaced or deleted.
+func doCmdHistory(handle string) error {
+	// Check if the DB exists.
+	if _, err := os.Stat(dbPath); err != nil {
+		return fmt.Errorf("cannot read database: %v", err)
+	}
+
+	revisions := []revisionOutput{}
+	err := safe.History(handle, func(rev uint64, revision *vault.Revision) {
+		revisions = append(revisions, revisionOutput{
+			Rev:     rev,
+			Time:    time.Unix(0, revision.Time),
+			Deleted: revision.Deleted,
+		})
+	})
+	if err != nil {
+		return err
+	}
+	return printOutput(revisions, func() {
+		for _, r := range revisions {
+			event := "replaced"
+			if r.Deleted {
+				event = "deleted"
+			}
+			fmt.Printf("%d\t%s\t%s\n", r.Rev, r.Time.Format(time.RFC3339), event)
+		}
+	})
+}
+
+// doCmdRestore executes subcommand 'restore', making revision rev of handle
+// the current command. The command it replaces is kept in the history.
+func doCmdRestore(handle string, rev uint64) (err error) {
+	start := time.Now()
+	defer func() { recordAudit(restoreCommand, handle, start, 0, err) }()
+
+	return safe.Restore(handle, rev)
+}
@@ -0,0 +1,65 @@
+// This file implements subcommand 'identity'.
+
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aleist/cmdsafe/crypto"
+)
+
+// defaultIdentityName is the name of the identity used if none is given.
+const defaultIdentityName = "default"
+
+// doCmdIdentity executes subcommand 'identity'. Action "new" generates an
+// identity with the given name, "export-public" prints its public key and
+// "list" prints all identities in the DB.
+func doCmdIdentity(action, name string) error {
+	switch action {
+	case "new":
+		identity, err := safe.NewIdentity(name)
+		if err != nil {
+			return err
+		}
+		fmt.Println(crypto.FormatPublicKey(identity.PublicKey))
+		return nil
+	case "export-public":
+		identity, err := safe.Identity(name)
+		if err != nil {
+			return err
+		}
+		fmt.Println(crypto.FormatPublicKey(identity.PublicKey))
+		return nil
+	}
+	return listIdentities()
+}
+
+// listIdentities prints the name, public key and creation time of all
+// identities in the DB.
+func listIdentities() error {
+	identities, err := safe.Identities()
+	if err != nil {
+		return err
+	}
+
+	type identityInfo struct {
+		Name      string    `json:"name"`
+		PublicKey string    `json:"public_key"`
+		Created   time.Time `json:"created"`
+	}
+	infos := make([]identityInfo, 0, len(identities))
+	for _, identity := range identities {
+		infos = append(infos, identityInfo{
+			Name:      identity.Name,
+			PublicKey: crypto.FormatPublicKey(identity.PublicKey),
+			Created:   time.Unix(identity.Created, 0),
+		})
+	}
+
+	return printOutput(infos, func() {
+		for _, info := range infos {
+			fmt.Printf("%s\t%s\t%s\n", info.Name, info.PublicKey, info.Created.Format(time.RFC3339))
+		}
+	})
+}
@@ -0,0 +1,208 @@
+// This file implements the sources supported by subcommand 'import'.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aleist/cmdsafe/vault"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/tobischo/gokeepasslib/v3"
+)
+
+// Supported import sources in addition to the age and gpg formats.
+const (
+	passSource    = "pass"
+	keepassSource = "keepass"
+)
+
+// An importer reads entries from an external source of secrets.
+type importer interface {
+	// Read returns the entry identified by name, e.g. a file path or the path
+	// of an entry within a password store.
+	Read(name string) (*importedEntry, error)
+}
+
+// importedEntry is an entry read by an importer. Sources holding complete
+// command configurations set Command, password managers set Fields, which the
+// command given on the command line refers to, see expandFields.
+type importedEntry struct {
+	Command *vault.Command
+	Fields  map[string]string // The secret fields by lower case name, e.g. "password".
+}
+
+// importers maps the supported sources to the constructors of their importer.
+var importers = map[string]func(config *importOptions) (importer, error){
+	ageFormat:     newFileImporter,
+	gpgFormat:     newFileImporter,
+	passSource:    newPassImporter,
+	keepassSource: newKeepassImporter,
+}
+
+// importSources returns the sorted names of the supported sources.
+func importSources() []string {
+	sources := make([]string, 0, len(importers))
+	for name := range importers {
+		sources = append(sources, name)
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+// fieldPattern matches a placeholder for an imported field, e.g. {{password}}.
+var fieldPattern = regexp.MustCompile(`\{\{([\w-]+)\}\}`)
+
+// expandFields replaces the placeholders {{<field>}} in arg with the values of
+// the corresponding fields. Returns an error if a field does not exist. The
+// {{totp}} placeholder is kept unless there is a field of that name.
+func expandFields(arg string, fields map[string]string) (string, error) {
+	var err error
+	expanded := fieldPattern.ReplaceAllStringFunc(arg, func(m string) string {
+		name := strings.ToLower(fieldPattern.FindStringSubmatch(m)[1])
+		value, ok := fields[name]
+		if !ok && m == vault.TOTPPlaceholder {
+			return m
+		}
+		if !ok && err == nil {
+			err = fmt.Errorf("the imported entry has no field %q", name)
+		}
+		return value
+	})
+	return expanded, err
+}
+
+// fileImporter reads command configurations from age or gpg encrypted files,
+// which hold them in the JSON form written by 'export'.
+type fileImporter struct {
+	format   string // Either "age" or "gpg".
+	identity string // The age identity file, if any.
+}
+
+func newFileImporter(config *importOptions) (importer, error) {
+	return &fileImporter{format: config.From, identity: config.Identity}, nil
+}
+
+// Read implements importer, name is the path of the file.
+func (imp *fileImporter) Read(name string) (*importedEntry, error) {
+	plaintext, err := decryptFile(imp.format, imp.identity, name)
+	if err != nil {
+		return nil, err
+	}
+
+	cmdData := &vault.Command{}
+	if err := jsonpb.Unmarshal(bytes.NewReader(plaintext), cmdData); err != nil {
+		return nil, fmt.Errorf("failed to parse the decrypted command: %v", err)
+	}
+	return &importedEntry{Command: cmdData}, nil
+}
+
+// decryptFile decrypts the file at path with the external tool for format,
+// using the age identity file if not empty.
+func decryptFile(format, identity, path string) ([]byte, error) {
+	var args []string
+	switch format {
+	case ageFormat:
+		args = []string{"--decrypt"}
+		if identity != "" {
+			args = append(args, "--identity", identity)
+		}
+	case gpgFormat:
+		args = []string{"--quiet", "--decrypt"}
+	}
+	return runExternalTool(format, append(args, path), nil, nil)
+}
+
+// passImporter reads entries from a pass password store, see
+// vault.ReadPassEntry.
+type passImporter struct {
+	dir string // The store directory, the default store if empty.
+}
+
+func newPassImporter(config *importOptions) (importer, error) {
+	return &passImporter{dir: config.Store}, nil
+}
+
+// Read implements importer, name is the path of the entry in the store without
+// the .gpg extension, e.g. "servers/server1".
+func (imp *passImporter) Read(name string) (*importedEntry, error) {
+	fields, err := vault.ReadPassEntry(imp.dir, name)
+	if err != nil {
+		return nil, err
+	}
+	return &importedEntry{Fields: fields}, nil
+}
+
+// keepassImporter reads entries from a KeePass KDBX file.
+type keepassImporter struct {
+	db *gokeepasslib.Database
+}
+
+func newKeepassImporter(config *importOptions) (importer, error) {
+	if config.Store == "" {
+		return nil, fmt.Errorf("the KDBX file must be given with -store")
+	}
+	file, err := os.Open(config.Store)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	pwd, err := promptPassword("Enter KeePass master password: ", false)
+	if err != nil {
+		return nil, err
+	}
+
+	db := gokeepasslib.NewDatabase()
+	db.Credentials = gokeepasslib.NewPasswordCredentials(string(pwd))
+	if err := gokeepasslib.NewDecoder(file).Decode(db); err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", config.Store, err)
+	}
+	if err := db.UnlockProtectedEntries(); err != nil {
+		return nil, fmt.Errorf("failed to open %s: %v", config.Store, err)
+	}
+	return &keepassImporter{db: db}, nil
+}
+
+// Read implements importer, name is the path of the entry below the root
+// group, made up of the group names and the entry title separated by slashes,
+// e.g. "servers/server1". All values of the entry are fields, e.g. "username"
+// and "password".
+func (imp *keepassImporter) Read(name string) (*importedEntry, error) {
+	for _, root := range imp.db.Content.Root.Groups {
+		if entry := findKeepassEntry(root, strings.Split(name, "/")); entry != nil {
+			fields := map[string]string{}
+			for _, v := range entry.Values {
+				fields[strings.ToLower(v.Key)] = v.Value.Content
+			}
+			return &importedEntry{Fields: fields}, nil
+		}
+	}
+	return nil, fmt.Errorf("no entry %s in the KeePass database", name)
+}
+
+// findKeepassEntry returns the entry at path below group, or nil if there is
+// none.
+func findKeepassEntry(group gokeepasslib.Group, path []string) *gokeepasslib.Entry {
+	if len(path) == 1 {
+		for i := range group.Entries {
+			if group.Entries[i].GetTitle() == path[0] {
+				return &group.Entries[i]
+			}
+		}
+		return nil
+	}
+
+	for _, g := range group.Groups {
+		if g.Name == path[0] {
+			if entry := findKeepassEntry(g, path[1:]); entry != nil {
+				return entry
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+// This file implements subcommands 'import' and 'export'.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/aleist/cmdsafe/vault"
+	"github.com/golang/protobuf/jsonpb"
+)
+
+// Supported external formats.
+const (
+	ageFormat = "age"
+	gpgFormat = "gpg"
+)
+
+type importOptions struct {
+	From     string // The source, see importers.
+	Identity string // The age identity file, if any.
+	Store    string // The password store directory or KDBX file.
+	Replace  bool   // Replace existing value.
+}
+
+type exportOptions struct {
+	To         string   // The format of the output, currently only "age".
+	Recipients []string // The age recipients to encrypt for.
+	Armor      bool     // Write PEM encoded output.
+	Output     string   // The output file, stdout if empty.
+}
+
+// stringList is a flag.Value collecting the values of a repeated flag.
+type stringList []string
+
+// String implements flag.Value.
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set implements flag.Value.
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// doCmdImport executes subcommand 'import', reading the entry identified by
+// name from the source config.From and saving it as a command under handle.
+//
+// Sources holding complete command configurations use the name stored with
+// them if handle is empty. For password managers, the command is given by
+// cmdArgs, whose placeholders {{<field>}} are replaced with the fields of the
+// entry, and handle defaults to the last element of name.
+func doCmdImport(handle, name string, cmdArgs []string, config *importOptions) error {
+	imp, err := importers[config.From](config)
+	if err != nil {
+		return err
+	}
+	entry, err := imp.Read(name)
+	if err != nil {
+		return err
+	}
+
+	cmdData := entry.Command
+	if cmdData == nil {
+		if len(cmdArgs) == 0 {
+			return fmt.Errorf("the command to run with the imported secrets must be given for %s", config.From)
+		}
+		cmdData = &vault.Command{Name: path.Base(name)}
+		for _, arg := range cmdArgs {
+			expanded, err := expandFields(arg, entry.Fields)
+			if err != nil {
+				return err
+			}
+			cmdData.Args = append(cmdData.Args, expanded)
+		}
+		cmdData.Executable, cmdData.Args = cmdData.Args[0], cmdData.Args[1:]
+		for i, arg := range cmdData.Args {
+			if arg != cmdArgs[i+1] {
+				cmdData.MarkSecretArg(i) // Holds imported fields.
+			}
+		}
+
+		// KeePassXC keeps the TOTP seed in the "otp" field.
+		if otp, ok := entry.Fields["otp"]; ok && cmdData.UsesTOTP() {
+			cmdData.Totp = &vault.Totp{}
+			if err := parseTOTPSeed(otp, cmdData.Totp); err != nil {
+				return err
+			}
+		}
+	} else if len(cmdArgs) > 0 {
+		return fmt.Errorf("%s files hold a complete command, no command may be given", config.From)
+	}
+
+	if handle == "" {
+		handle = cmdData.Name
+	}
+	if handle == "" {
+		return fmt.Errorf("the imported command has no name, use -name to set one")
+	}
+	if cmdData.Executable == "" {
+		return fmt.Errorf("the imported command has no executable")
+	}
+	cmdData.Name = handle
+
+	return doCmdSave(handle, cmdData, &saveOptions{Replace: config.Replace})
+}
+
+// doCmdExport executes subcommand 'export', writing the command identified by
+// handle in JSON form, encrypted with the external tool for config.To.
+func doCmdExport(handle string, config *exportOptions) (err error) {
+	start := time.Now()
+	defer func() { recordAudit(exportCommand, handle, start, 0, err) }()
+
+	cmdData, err := safe.Get(handle)
+	if err != nil {
+		return err
+	}
+
+	var plaintext bytes.Buffer
+	marshaler := jsonpb.Marshaler{OrigName: true, Indent: "  "}
+	if err := marshaler.Marshal(&plaintext, cmdData); err != nil {
+		return fmt.Errorf("failed to serialise the command data: %v", err)
+	}
+
+	args := []string{"--encrypt"}
+	for _, r := range config.Recipients {
+		args = append(args, "--recipient", r)
+	}
+	if config.Armor {
+		args = append(args, "--armor")
+	}
+	if config.Output != "" {
+		args = append(args, "--output", config.Output)
+	}
+	_, err = runExternalTool(config.To, args, &plaintext, os.Stdout)
+	return err
+}
+
+// runExternalTool runs the external tool name with args, feeding it stdin if
+// not nil. Its output is written to stdout if not nil and returned otherwise.
+// The tool's stderr is passed through, so that it can report errors and ask for
+// passphrases.
+func runExternalTool(name string, args []string, stdin *bytes.Buffer, stdout *os.File) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	} else {
+		cmd.Stdin = os.Stdin
+	}
+	cmd.Stderr = os.Stderr
+
+	var output bytes.Buffer
+	if stdout != nil {
+		cmd.Stdout = stdout
+	} else {
+		cmd.Stdout = &output
+	}
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %v", name, err)
+	}
+	return output.Bytes(), nil
+}
@@ -5,51 +5,77 @@ package main
 import (
 	"fmt"
 	"os"
-
-	"github.com/boltdb/bolt"
+	"sort"
+	"time"
 )
 
+// expiringStatus is the exit status of 'list -expiring' if it lists any
+// commands, for scripts to alert on.
+const expiringStatus = 3
+
+type listOptions struct {
+	Expiring bool          // Only list the commands expiring within Within.
+	Within   time.Duration // See Expiring.
+}
+
+// expiryOutput is the JSON form of a command printed by 'list -expiring'.
+type expiryOutput struct {
+	Handle  string    `json:"handle"`
+	Expires time.Time `json:"expires"`
+}
+
 // doCmdList executes subcommand 'list', printing the handles of all stored
-// command entries.
-func doCmdList() error {
-	// Check if the DB file is readable.
-	info, err := os.Stat(dbPath)
-	if err != nil || !info.Mode().IsRegular() {
-		return fmt.Errorf("cannot read database: %v", err)
+// command entries. With config.Expiring, it only prints the commands past or
+// within config.Within of their expiry dates together with the dates, and
+// returns expiringStatus if there are any.
+func doCmdList(config *listOptions) (status int, err error) {
+	// Check if the DB exists.
+	if _, err := os.Stat(dbPath); err != nil {
+		return 0, fmt.Errorf("cannot read database: %v", err)
+	}
+	if config.Expiring {
+		return listExpiring(config.Within)
 	}
 
 	// Retrieve and print handles.
-	handles, err := commandList()
+	handles, err := safe.List()
 	if err != nil {
-		return err
+		return 0, err
 	}
-	for _, v := range handles {
-		fmt.Println(v)
+	if handles == nil {
+		handles = []string{}
 	}
-
-	return nil
+	return 0, printOutput(handles, func() {
+		for _, v := range handles {
+			fmt.Println(v)
+		}
+	})
 }
 
-// commandList queries the DB and returns a list of all the command handles
-// stored in it.
-func commandList() ([]string, error) {
-	var handles []string
-	err := accessDB(true, func(db *bolt.DB) error {
-		return db.View(func(tx *bolt.Tx) error {
-			cmdBucket := tx.Bucket([]byte(commandBucketName))
-			if cmdBucket == nil {
-				return nil // DB structure has not been created, treat as empty.
-			}
-
-			// Iterate over keys.
-			c := cmdBucket.Cursor()
-			for k, _ := c.First(); k != nil; k, _ = c.Next() {
-				// Converting the key to string also copies it, do not return []byte.
-				handles = append(handles, string(k))
-			}
-			return nil
-		})
-	})
+// listExpiring implements 'list -expiring' for commands expiring within the
+// given duration.
+func listExpiring(within time.Duration) (status int, err error) {
+	expiries, err := safe.Expiries()
+	if err != nil {
+		return 0, err
+	}
 
-	return handles, err
+	due := []expiryOutput{}
+	deadline := time.Now().Add(within)
+	for handle, expires := range expiries {
+		if expires.Before(deadline) {
+			due = append(due, expiryOutput{Handle: handle, Expires: expires})
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Expires.Before(due[j].Expires) })
+
+	err = printOutput(due, func() {
+		for _, e := range due {
+			fmt.Printf("%s\t%s\n", e.Handle, e.Expires.Format(time.RFC3339))
+		}
+	})
+	if err == nil && len(due) > 0 {
+		status = expiringStatus
+	}
+	return status, err
 }
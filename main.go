@@ -7,17 +7,20 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
-	"github.com/boltdb/bolt"
+	"github.com/aleist/cmdsafe/crypto"
+	"github.com/aleist/cmdsafe/vault"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
 var (
-	progName string      // The name of this executable.
-	dbPath   = "data.db" // The path to the DB file.
+	progName string       // The name of this executable.
+	dbPath   string       // The path to the DB file, see resolveDBPath.
+	safe     *vault.Vault // The vault at dbPath, opened by main.
 )
 
 // command is the type of a valid subcommand.
@@ -25,49 +28,138 @@ type command string
 
 // Valid subcommands.
 const (
-	deleteCommand command = "delete"
-	listCommand   command = "list"
-	printCommand  command = "print"
-	runCommand    command = "run"
-	saveCommand   command = "save"
+	agentCommand        command = "agent"
+	auditCommand        command = "audit"
+	compactCommand      command = "compact"
+	configCommand       command = "config"
+	deleteCommand       command = "delete"
+	exportCommand       command = "export"
+	fsckCommand         command = "fsck"
+	historyCommand      command = "history"
+	identityCommand     command = "identity"
+	importCommand       command = "import"
+	listCommand         command = "list"
+	migrateCommand      command = "migrate"
+	migrateStoreCommand command = "migrate-store"
+	printCommand        command = "print"
+	restoreCommand      command = "restore"
+	runCommand          command = "run"
+	saveCommand         command = "save"
+	shareCommand        command = "share"
+	totpCommand         command = "totp"
+	trashCommand        command = "trash"
+	undeleteCommand     command = "undelete"
+	unshareCommand      command = "unshare"
+	whereCommand        command = "where"
+
+	execShimCommand command = vault.ShimCommand // Internal, runs a hardened command.
 )
 
-// Database constants.
-const (
-	configBucketName  = "config"  // The config bucket.
-	commandBucketName = "command" // The command data bucket.
-)
+// commands lists the valid subcommands, which cannot be used as alias names.
+var commands = []command{agentCommand, auditCommand, compactCommand, configCommand, deleteCommand,
+	exportCommand, fsckCommand, historyCommand, identityCommand, importCommand, listCommand,
+	migrateCommand, migrateStoreCommand, printCommand, restoreCommand, runCommand, saveCommand,
+	shareCommand, totpCommand, trashCommand, undeleteCommand, unshareCommand, whereCommand,
+	execShimCommand}
 
 func main() {
 	// Parse global arguments.
 	subcmd, subargs := parseArgs()
 
-	// Parse subcommand arguments and run it.
+	// Open the vault for the subcommands using it.
 	var status int
 	var err error
 	switch subcmd {
+	case configCommand, whereCommand, execShimCommand:
+		// No DB access.
+	default:
+		if safe, err = openVault(); err != nil {
+			logError(err)
+			os.Exit(1)
+		}
+	}
+
+	// Parse subcommand arguments and run it.
+	switch subcmd {
+	case agentCommand:
+		idle := parseArgsCmdAgent(subargs)
+		err = doCmdAgent(idle)
+	case auditCommand:
+		// No arguments to parse.
+		err = doCmdAudit()
+	case compactCommand:
+		secure := parseArgsCmdCompact(subargs)
+		err = doCmdCompact(secure)
+	case configCommand:
+		action, key, value := parseArgsCmdConfig(subargs)
+		err = doCmdConfig(action, key, value)
 	case deleteCommand:
-		cmdHandle := parseArgsCmdDelete(subargs)
-		err = doCmdDelete(cmdHandle)
+		cmdHandle, purge := parseArgsCmdDelete(subargs)
+		err = doCmdDelete(cmdHandle, purge)
+	case exportCommand:
+		cmdHandle, config := parseArgsCmdExport(subargs)
+		err = doCmdExport(cmdHandle, config)
+	case fsckCommand:
+		config := parseArgsCmdFsck(subargs)
+		err = doCmdFsck(config)
+	case historyCommand:
+		cmdHandle := parseArgsCmdHistory(subargs)
+		err = doCmdHistory(cmdHandle)
+	case identityCommand:
+		action, name := parseArgsCmdIdentity(subargs)
+		err = doCmdIdentity(action, name)
+	case importCommand:
+		cmdHandle, name, cmdArgs, config := parseArgsCmdImport(subargs)
+		err = doCmdImport(cmdHandle, name, cmdArgs, config)
 	case listCommand:
+		config := parseArgsCmdList(subargs)
+		status, err = doCmdList(config)
+	case migrateCommand:
 		// No arguments to parse.
-		err = doCmdList()
+		err = doCmdMigrate()
+	case migrateStoreCommand:
+		backend, path := parseArgsCmdMigrateStore(subargs)
+		err = doCmdMigrateStore(backend, path)
 	case printCommand:
-		cmdHandle := parseArgsCmdPrint(subargs)
-		err = doCmdPrint(cmdHandle)
+		cmdHandle, redact := parseArgsCmdPrint(subargs)
+		err = doCmdPrint(cmdHandle, redact)
+	case restoreCommand:
+		cmdHandle, rev := parseArgsCmdRestore(subargs)
+		err = doCmdRestore(cmdHandle, rev)
 	case runCommand:
-		cmdHandle, config := parseArgsCmdRun(subargs)
-		status, err = doCmdRun(cmdHandle, config)
+		cmdHandle, config, dryRun := parseArgsCmdRun(subargs)
+		status, err = doCmdRun(cmdHandle, config, dryRun)
 	case saveCommand:
 		cmdHandle, cmdData, config := parseArgsCmdSave(subargs)
 		err = doCmdSave(cmdHandle, cmdData, config)
+	case shareCommand:
+		cmdHandle, config := parseArgsCmdShare(shareCommand, subargs)
+		err = doCmdShare(cmdHandle, config)
+	case totpCommand:
+		cmdHandle := parseArgsCmdTotp(subargs)
+		err = doCmdTotp(cmdHandle)
+	case trashCommand:
+		action, olderThan := parseArgsCmdTrash(subargs)
+		err = doCmdTrash(action, olderThan)
+	case undeleteCommand:
+		cmdHandle := parseArgsCmdUndelete(subargs)
+		err = doCmdUndelete(cmdHandle)
+	case unshareCommand:
+		cmdHandle, config := parseArgsCmdShare(unshareCommand, subargs)
+		err = doCmdUnshare(cmdHandle, config)
+	case whereCommand:
+		// No arguments to parse.
+		err = doCmdWhere()
+	case execShimCommand:
+		// No arguments to parse, the command is read from a pipe.
+		status, err = vault.ExecShim()
 	default:
 		_, _ = fmt.Fprintf(os.Stderr, "Unknown command: %s\n", subcmd)
 		flag.Usage()
 		os.Exit(2)
 	}
 	if err != nil {
-		log.Print(err)
+		logError(err)
 	}
 
 	if status == 0 && err != nil {
@@ -76,6 +168,14 @@ func main() {
 	os.Exit(status)
 }
 
+// logError logs err, followed by a hint for the errors the user can avoid.
+func logError(err error) {
+	log.Print(err)
+	if _, ok := err.(*vault.LockedError); ok {
+		log.Print("Set lock_timeout to wait longer, or run 'cmdsafe agent' to serialise access")
+	}
+}
+
 // parseArgs parses the global command line arguments and returns the specified
 // subcommand and its unparsed arguments.
 func parseArgs() (command, []string) {
@@ -89,68 +189,339 @@ func parseArgs() (command, []string) {
 		_, _ = fmt.Fprintln(os.Stderr, "Global flags:")
 		flag.PrintDefaults()
 		_, _ = fmt.Fprintln(os.Stderr, "\nThe commands are:")
-		_, _ = fmt.Fprintln(os.Stderr, "  delete\tdelete a saved command")
+		_, _ = fmt.Fprintln(os.Stderr, "  agent \tserve the database to concurrent cmdsafe processes")
+		_, _ = fmt.Fprintln(os.Stderr, "  audit \tshow and verify the audit log")
+		_, _ = fmt.Fprintln(os.Stderr, "  compact\trewrite the database into a fresh file, leaving out deleted data")
+		_, _ = fmt.Fprintln(os.Stderr, "  config\tget or set user configuration values")
+		_, _ = fmt.Fprintln(os.Stderr, "  delete\tmove a saved command into the trash")
+		_, _ = fmt.Fprintln(os.Stderr, "  export\twrite a saved command to an age encrypted file")
+		_, _ = fmt.Fprintln(os.Stderr, "  fsck  \tcheck the integrity of all saved commands")
+		_, _ = fmt.Fprintln(os.Stderr, "  history\tlist the previous revisions of a saved command")
+		_, _ = fmt.Fprintln(os.Stderr, "  identity\tmanage the key pairs commands can be shared with")
+		_, _ = fmt.Fprintln(os.Stderr, "  import\tsave a command from an encrypted file or password manager")
 		_, _ = fmt.Fprintln(os.Stderr, "  list  \tlist all saved commands")
-		_, _ = fmt.Fprintln(os.Stderr, "  print \tprint a command configuration to stdout")
+		_, _ = fmt.Fprintln(os.Stderr, "  migrate\tupgrade the database written by an older version")
+		_, _ = fmt.Fprintln(os.Stderr, "  migrate-store\tcopy the database into a new store of another backend")
+		_, _ = fmt.Fprintln(os.Stderr, "  print \tprint a command configuration to stdout, optionally redacted")
+		_, _ = fmt.Fprintln(os.Stderr, "  restore\trestore a previous revision of a saved command")
 		_, _ = fmt.Fprintln(os.Stderr, "  run   \trun a saved command")
 		_, _ = fmt.Fprintln(os.Stderr, "  save  \tsave a new or update an existing command")
+		_, _ = fmt.Fprintln(os.Stderr, "  share \tadd a password or public key able to decrypt a saved command")
+		_, _ = fmt.Fprintln(os.Stderr, "  totp  \tprint the current TOTP code of a saved command")
+		_, _ = fmt.Fprintln(os.Stderr, "  trash \tlist or empty the deleted commands")
+		_, _ = fmt.Fprintln(os.Stderr, "  undelete\trestore a deleted command from the trash")
+		_, _ = fmt.Fprintln(os.Stderr, "  unshare\tremove a password or public key from a saved command")
+		_, _ = fmt.Fprintln(os.Stderr, "  where \tshow the database path in use")
+	}
+
+	// Load the user configuration, which the flags override. A broken file
+	// must not lock the user out of all subcommands.
+	if userCfgErr = loadUserConfig(); userCfgErr != nil {
+		log.Printf("Warning: %v, using the defaults", userCfgErr)
 	}
 
 	// Parse general arguments.
-	flag.StringVar(&dbPath, "db", dbPath, "The database `path`")
+	flag.StringVar(&dbPath, "db", "", "The database `path` (default: $"+dbPathEnv+", the closest "+
+		projectFileName+" file, the config file, or $XDG_DATA_HOME/cmdsafe/"+defaultDBFileName+")")
 	flag.Parse()
 
+	if err := resolveDBPath(); err != nil {
+		log.Fatal(err)
+	}
+
 	// Extract the subcommand.
 	args := flag.Args()
 	if len(args) == 0 {
 		flag.Usage()
 		os.Exit(2)
 	}
+	args = userCfg.expandAlias(args)
 	return command(args[0]), args[1:]
 }
 
+// parseArgsCmdAgent parses arguments specific to subcommand 'agent'. Returns
+// the idle time after which the agent exits, 0 for none.
+func parseArgsCmdAgent(args []string) (idle time.Duration) {
+	flags := flag.NewFlagSet("agent", flag.ExitOnError)
+	flags.DurationVar(&idle, "idle", time.Duration(userCfg.AgentTimeout),
+		"Exit after being unused for this `duration`, 0 to run until interrupted")
+
+	err := flags.Parse(args)
+	if err != nil || flags.NArg() != 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: agent [-idle duration]\n")
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	return idle
+}
+
+// parseArgsCmdCompact parses arguments specific to subcommand 'compact'.
+// Returns whether to overwrite the old database file.
+func parseArgsCmdCompact(args []string) (secure bool) {
+	flags := flag.NewFlagSet("compact", flag.ExitOnError)
+	flags.BoolVar(&secure, "secure", false, "Overwrite the old database file with zeros before it is removed")
+
+	err := flags.Parse(args)
+	if err != nil || flags.NArg() != 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: compact [-secure]\n")
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	return secure
+}
+
+// parseArgsCmdConfig parses arguments specific to subcommand 'config'. Returns
+// the action, either "get" or "set", the config key and for "set" its value.
+func parseArgsCmdConfig(args []string) (action, key, value string) {
+	switch {
+	case len(args) == 1 && args[0] == "get":
+		return args[0], "", ""
+	case len(args) == 2 && args[0] == "get":
+		return args[0], args[1], ""
+	case len(args) == 3 && args[0] == "set":
+		return args[0], args[1], args[2]
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "Usage: config get [<key>] | config set <key> <value>\n")
+	_, _ = fmt.Fprintf(os.Stderr, "Keys: %s, alias.<name>\n", strings.Join(configKeys, ", "))
+	os.Exit(2)
+	return
+}
+
+// parseArgsCmdShare parses arguments specific to subcommands 'share' and
+// 'unshare', given by subcmd. Returns the handle for the external command to be
+// shared or unshared and the recipient options.
+func parseArgsCmdShare(subcmd command, args []string) (cmdHandle string, config *shareOptions) {
+	flags := flag.NewFlagSet(string(subcmd), flag.ExitOnError)
+
+	config = &shareOptions{}
+	flags.BoolVar(&config.Password, "password", false, "The recipient is a password")
+	publicKey := flags.String("to", "", "The recipient is the X25519 public `key`")
+
+	err := flags.Parse(args)
+	cmdArgs := flags.Args()
+	if err == nil && *publicKey != "" {
+		config.PublicKey, err = crypto.ParsePublicKey(*publicKey)
+	}
+	if err != nil || len(cmdArgs) != 1 || config.Password == (*publicKey != "") {
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: %s -password | -to <key> <cmd name>\n", subcmd)
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	return cmdArgs[0], config
+}
+
 // parseArgsCmdDelete parses arguments specific to subcommand 'delete'. Returns
-// the handle for the external command to be deleted.
-func parseArgsCmdDelete(args []string) (cmdHandle string) {
+// the handle for the external command to be deleted and whether to remove it
+// immediately instead of moving it into the trash.
+func parseArgsCmdDelete(args []string) (cmdHandle string, purge bool) {
+	flags := flag.NewFlagSet("delete", flag.ExitOnError)
+	flags.BoolVar(&purge, "purge", false, "Remove the cmd with its trash and history entries immediately")
+
+	err := flags.Parse(args)
+	if err != nil || flags.NArg() != 1 {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: delete [-purge] <cmd name>\n")
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	return flags.Arg(0), purge
+}
+
+// parseArgsCmdExport parses arguments specific to subcommand 'export'.
+// Returns the handle for the external command to be exported and the export
+// options.
+func parseArgsCmdExport(args []string) (cmdHandle string, config *exportOptions) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+
+	config = &exportOptions{}
+	flags.StringVar(&config.To, "to", "", "The output `format`, currently only "+ageFormat)
+	flags.Var((*stringList)(&config.Recipients), "recipient", "Encrypt for this age `recipient`, may be repeated")
+	flags.BoolVar(&config.Armor, "a", false, "Write PEM encoded output")
+	flags.StringVar(&config.Output, "o", "", "Write to this `file` instead of stdout")
+
+	err := flags.Parse(args)
+	cmdArgs := flags.Args()
+	if err != nil || len(cmdArgs) != 1 || config.To != ageFormat || len(config.Recipients) == 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: export -to age -recipient <recipient> [-a] [-o file] <cmd name>\n")
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	return cmdArgs[0], config
+}
+
+// parseArgsCmdFsck parses arguments specific to subcommand 'fsck'. Returns the
+// check options.
+func parseArgsCmdFsck(args []string) (config *fsckOptions) {
+	flags := flag.NewFlagSet("fsck", flag.ExitOnError)
+
+	config = &fsckOptions{}
+	flags.BoolVar(&config.Password, "p", false, "Ask for a password to verify the entries it decrypts")
+	flags.BoolVar(&config.Quarantine, "quarantine", false, "Move broken entries into a separate bucket")
+
+	err := flags.Parse(args)
+	if err != nil || flags.NArg() != 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: fsck [-p] [-quarantine]\n")
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	return config
+}
+
+// parseArgsCmdHistory parses arguments specific to subcommand 'history'.
+// Returns the handle for the external command whose history is listed.
+func parseArgsCmdHistory(args []string) (cmdHandle string) {
 	if len(args) != 1 {
-		_, _ = fmt.Fprintf(os.Stderr, "Usage: delete <cmd name>\n")
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: history <cmd name>\n")
 		os.Exit(2)
 	}
 	return args[0]
 }
 
+// parseArgsCmdIdentity parses arguments specific to subcommand 'identity'.
+// Returns the action, one of "new", "export-public" or "list", and for the
+// former two the identity name.
+func parseArgsCmdIdentity(args []string) (action, name string) {
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		return args[0], ""
+	case len(args) == 1 && (args[0] == "new" || args[0] == "export-public"):
+		return args[0], defaultIdentityName
+	case len(args) == 2 && (args[0] == "new" || args[0] == "export-public"):
+		return args[0], args[1]
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "Usage: identity new [<name>] | identity export-public [<name>] | identity list\n")
+	os.Exit(2)
+	return
+}
+
+// parseArgsCmdImport parses arguments specific to subcommand 'import'.
+// Returns the handle to save the command under, which may be empty, the name
+// of the entry to import, the command referring to its fields, if any, and the
+// import options.
+func parseArgsCmdImport(args []string) (cmdHandle, name string, cmdArgs []string,
+		config *importOptions) {
+
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+
+	config = &importOptions{}
+	flags.StringVar(&config.From, "from", "", "The `source`, one of "+strings.Join(importSources(), ", "))
+	flags.StringVar(&config.Identity, "i", "", "The age identity `file` (age only)")
+	flags.StringVar(&config.Store, "store", "", "The password store `path` (pass) or KDBX file (keepass)")
+	flags.StringVar(&cmdHandle, "name", "", "The name used to refer to the saved cmd (default: the name of the entry)")
+	flags.BoolVar(&config.Replace, "r", false, "Replace existing entry with the given name")
+
+	err := flags.Parse(args)
+	posArgs := flags.Args()
+	_, validSource := importers[config.From]
+	if err != nil || len(posArgs) < 1 || !validSource || (config.Identity != "" && config.From != ageFormat) {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: import -from age|gpg [-i identity] [-r] [-name name] <file>\n")
+		_, _ = fmt.Fprintf(os.Stderr, "       import -from pass|keepass [-store path] [-r] [-name name] <entry> <cmd> [<cmd args> ...]\n")
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	return cmdHandle, posArgs[0], posArgs[1:], config
+}
+
+// parseArgsCmdList parses arguments specific to subcommand 'list'. Returns the
+// list options.
+func parseArgsCmdList(args []string) (config *listOptions) {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+
+	config = &listOptions{}
+	flags.Var((*age)(&config.Within), "expiring", "Only list cmds expiring within this `age`, e.g. 14d, with their expiry dates")
+
+	err := flags.Parse(args)
+	if err != nil || flags.NArg() != 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: list [-expiring age]\n")
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "expiring" {
+			config.Expiring = true
+		}
+	})
+	return config
+}
+
+// parseArgsCmdMigrateStore parses arguments specific to subcommand
+// 'migrate-store'. Returns the backend and path of the new store.
+func parseArgsCmdMigrateStore(args []string) (backend, path string) {
+	flags := flag.NewFlagSet("migrate-store", flag.ExitOnError)
+	flags.StringVar(&backend, "to", "", "The storage `backend` of the new store, one of "+
+		strings.Join(vault.Backends(), ", "))
+
+	err := flags.Parse(args)
+	if err != nil || flags.NArg() != 1 || backend == "" {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: migrate-store -to %s <path>\n", strings.Join(vault.Backends(), "|"))
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+	return backend, flags.Arg(0)
+}
+
 // parseArgsCmdPrint parses arguments specific to subcommand 'print'. Returns
-// the handle for the external command to be printed.
-func parseArgsCmdPrint(args []string) (cmdHandle string) {
-	if len(args) != 1 {
-		_, _ = fmt.Fprintf(os.Stderr, "Usage: print <cmd name>\n")
+// the handle for the external command to be printed and whether to mask its
+// secrets.
+func parseArgsCmdPrint(args []string) (cmdHandle string, redact bool) {
+	flags := flag.NewFlagSet("print", flag.ExitOnError)
+	flags.BoolVar(&redact, "redact", false, "Mask the values marked as secret")
+
+	err := flags.Parse(args)
+	if err != nil || flags.NArg() != 1 {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: print [-redact] <cmd name>\n")
+		flags.PrintDefaults()
 		os.Exit(2)
 	}
-	return args[0]
+	return flags.Arg(0), redact
+}
+
+// parseArgsCmdRestore parses arguments specific to subcommand 'restore'.
+// Returns the handle for the external command to be restored and the revision
+// to restore, as listed by subcommand 'history'.
+func parseArgsCmdRestore(args []string) (cmdHandle string, rev uint64) {
+	var err error
+	if len(args) == 2 {
+		rev, err = strconv.ParseUint(args[1], 10, 64)
+	}
+	if len(args) != 2 || err != nil || rev == 0 {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: restore <cmd name> <revision>\n")
+		os.Exit(2)
+	}
+	return args[0], rev
 }
 
 // parseArgsCmdRun parses arguments specific to subcommand 'run'. Returns the
-// handle for the external command to be run and additional run options.
-func parseArgsCmdRun(args []string) (cmdHandle string, config *runOptions) {
+// handle for the external command to be run, additional run options and
+// whether to only print the command.
+func parseArgsCmdRun(args []string) (cmdHandle string, config *vault.RunOptions, dryRun bool) {
 	flags := flag.NewFlagSet("run", flag.ExitOnError)
 
-	config = &runOptions{}
+	config = &vault.RunOptions{OnExpired: onExpired, Confirm: confirmRun}
 	flags.BoolVar(&config.Detached, "d", false, "Run the command in detached mode")
+	flags.DurationVar(&config.Timeout, "timeout", time.Duration(userCfg.RunTimeout),
+		"Terminate the command after this `duration`, 0 for no limit (ignored if detached)")
+	flags.StringVar(&config.Reason, "reason", "", "Record this `text` in the audit log as the reason for the run")
+	flags.BoolVar(&dryRun, "dry-run", false, "Print the resolved cmd with its secrets masked instead of running it")
 
 	err := flags.Parse(args)
 	cmdArgs := flags.Args()
 	if err != nil || len(cmdArgs) < 1 {
-		_, _ = fmt.Fprintf(os.Stderr, "Usage: run [-d] <cmd name> [<cmd args> ...]\n")
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: run [-d] [-timeout duration] [-reason text] [-dry-run] <cmd name> [<cmd args> ...]\n")
 		flags.PrintDefaults()
 		os.Exit(2)
 	}
 	config.Args = cmdArgs[1:]
-	return cmdArgs[0], config
+	return cmdArgs[0], config, dryRun
 }
 
 // parseArgsCmdSave parses arguments specific to subcommand 'save'. Returns the
 // handle for the external command to be saved, its data and the save config.
-func parseArgsCmdSave(args []string) (cmdHandle string, cmdData *Command,
+func parseArgsCmdSave(args []string) (cmdHandle string, cmdData *vault.Command,
 		config *saveOptions) {
 
 	flags := flag.NewFlagSet("save", flag.ExitOnError)
@@ -158,60 +529,232 @@ func parseArgsCmdSave(args []string) (cmdHandle string, cmdData *Command,
 	config = &saveOptions{}
 	flags.StringVar(&cmdHandle, "name", "", "The name used to refer to the saved cmd")
 	flags.BoolVar(&config.Replace, "r", false, "Replace existing entry with the given name")
+	flags.BoolVar(&config.Interactive, "interactive", false, "Ask for the name, cmd, arguments and environment step by step")
+	sandbox := flags.Bool("sandbox", false, "Run the cmd in new PID, mount and IPC namespaces (Linux only)")
+	seccomp := flags.Bool("seccomp", false, "Deny process inspection syscalls to the cmd (implies -sandbox)")
+	scrub := flags.Duration("scrub", 0, "Overwrite the cmd's arguments in its memory after this `delay` (Linux only)")
+	totp := flags.Bool("totp", false, "Ask for a TOTP seed for the "+vault.TOTPPlaceholder+" placeholder")
+	totpDigits := flags.Uint("totp-digits", vault.DefaultTOTPDigits, "The number of `digits` of a TOTP code")
+	totpPeriod := flags.Duration("totp-period", vault.DefaultTOTPPeriod, "The TOTP time step `duration`")
+	totpAlgo := flags.String("totp-algo", vault.Totp_SHA1.String(), "The TOTP hash `algorithm`: SHA1, SHA256 or SHA512")
+	var env, tokens, generators, secretArgs, secretEnv stringList
+	flags.Var(&generators, "generate", "Generate a random secret for the placeholder {{name}} from `name:length[:charset]`, may be repeated")
+	flags.BoolVar(&config.Show, "show", false, "Print the generated secrets once saved")
+	flags.BoolVar(&config.Clip, "clip", false, "Copy the generated secret to the clipboard once saved")
+	flags.Var(&env, "env", "Set the environment variable `name=value` for the cmd, may be repeated")
+	flags.Var(&secretArgs, "secret-arg", "Mark the cmd argument at this 1-based `index` as secret, may be repeated")
+	flags.Var(&secretEnv, "secret-env", "Mark the environment variable `name` as secret, may be repeated")
+	flags.Var(&tokens, "token", "Ask for an access token of the secret resolver for `scheme`, may be repeated")
+	expires := flags.String("expires", "", "Warn when running the cmd from this `date` (YYYY-MM-DD) or after this age, e.g. 90d")
+	policy := &vault.Policy{}
+	flags.BoolVar(&policy.RequireConfirm, "require-confirm", false, "Require typing the name to confirm each run")
+	flags.StringVar(&policy.AllowHours, "allow-hours", "", "Only allow runs within this local time `range`, e.g. 09:00-17:00")
+	flags.BoolVar(&policy.RequireReason, "require-reason", false, "Require a reason for each run, recorded in the audit log")
+	flags.BoolVar(&policy.RequireTty, "require-tty", false, "Deny runs unless stdin is a terminal")
 
 	err := flags.Parse(args)
 	cmdArgs := flags.Args()
-	if err != nil || cmdHandle == "" || len(cmdArgs) < 1 {
-		_, _ = fmt.Fprintf(os.Stderr, "Usage: save [-r] -name <name> <cmd> [<cmd args> ...]\n")
+	for _, v := range env {
+		if i := strings.Index(v, "="); err == nil && i <= 0 {
+			err = fmt.Errorf("invalid environment variable %q, want name=value", v)
+		}
+	}
+	if config.Interactive && len(secretArgs) > 0 {
+		err = fmt.Errorf("-secret-arg cannot be used with -interactive, enter secret arguments as '%s'", secretMarker)
+	}
+	var secretIndexes []int
+	for _, v := range secretArgs {
+		i, e := strconv.Atoi(v)
+		if err == nil && (e != nil || i < 1 || i >= len(cmdArgs)) {
+			err = fmt.Errorf("invalid secret argument index %q, want 1 to %d", v, len(cmdArgs)-1)
+		}
+		secretIndexes = append(secretIndexes, i-1)
+	}
+	for _, name := range secretEnv {
+		set := false
+		for _, v := range env {
+			set = set || strings.HasPrefix(v, name+"=")
+		}
+		if err == nil && !set {
+			err = fmt.Errorf("the secret environment variable %s is not set with -env", name)
+		}
+	}
+	for _, spec := range generators {
+		gen, e := parseSecretGenerator(spec)
+		if err == nil && e != nil {
+			err = e
+		}
+		config.Generators = append(config.Generators, gen)
+	}
+	if err == nil && (config.Show || config.Clip) && len(generators) == 0 {
+		err = fmt.Errorf("-show and -clip require -generate")
+	}
+	if err == nil && config.Clip && len(generators) > 1 {
+		err = fmt.Errorf("-clip requires a single -generate")
+	}
+	totpAlgoValue, validAlgo := vault.Totp_Algorithm_value[strings.ToUpper(*totpAlgo)]
+	if err == nil && !validAlgo {
+		err = fmt.Errorf("unsupported TOTP algorithm %q", *totpAlgo)
+	}
+	if err == nil && (*totpPeriod < time.Second || *totpDigits < 6 || *totpDigits > 10) {
+		err = fmt.Errorf("invalid TOTP parameters, want 6 to 10 digits and a period of at least 1s")
+	}
+	var expiry time.Time
+	if err == nil && *expires != "" {
+		expiry, err = parseExpiry(*expires)
+	}
+	if err == nil {
+		err = policy.Validate()
+	}
+	missingArgs := cmdHandle == "" || len(cmdArgs) < 1
+	if config.Interactive {
+		missingArgs = len(cmdArgs) > 0
+	}
+	if err != nil || missingArgs {
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: save -interactive [-name <name>] [flags ...]\n")
+		_, _ = fmt.Fprintf(os.Stderr, "       save [-r] [-sandbox] [-seccomp] [-scrub delay] [-env name=value ...] [-secret-arg index ...] [-secret-env name ...] [-token scheme ...] [-totp ...] [-generate name:length[:charset] ... [-show] [-clip]] [-expires date] [-require-confirm] [-allow-hours range] [-require-reason] [-require-tty] -name <name> <cmd> [<cmd args> ...]\n")
 		flags.PrintDefaults()
 		os.Exit(2)
 	}
 
 	// Init the external command struct.
-	cmdData = &Command{}
+	cmdData = &vault.Command{}
 	cmdData.Name = cmdHandle
-	cmdData.Executable = cmdArgs[0]
+	if len(cmdArgs) > 0 {
+		cmdData.Executable = cmdArgs[0]
+	}
 	if len(cmdArgs) > 1 {
 		cmdData.Args = cmdArgs[1:]
 	}
+	if *sandbox || *seccomp {
+		cmdData.Sandbox = &vault.Sandbox{Seccomp: *seccomp}
+	}
+	if *scrub > 0 {
+		cmdData.ArgScrub = &vault.ArgScrub{DelayMs: int64(*scrub / time.Millisecond)}
+	}
+	for _, v := range env {
+		if cmdData.Env == nil {
+			cmdData.Env = map[string]string{}
+		}
+		parts := strings.SplitN(v, "=", 2)
+		cmdData.Env[parts[0]] = parts[1]
+	}
+	for _, i := range secretIndexes {
+		cmdData.MarkSecretArg(i)
+	}
+	for _, name := range secretEnv {
+		cmdData.MarkSecretEnv(name)
+	}
+	if !expiry.IsZero() {
+		cmdData.Expires = expiry.UnixNano()
+	}
+	if *policy != (vault.Policy{}) {
+		cmdData.Policy = policy
+	}
+	config.Tokens = tokens
+	config.Prompts = findPrompts(cmdData)
+	if *totp {
+		cmdData.Totp = &vault.Totp{
+			Digits:    uint32(*totpDigits),
+			Period:    uint32(*totpPeriod / time.Second),
+			Algorithm: vault.Totp_Algorithm(totpAlgoValue),
+		}
+	}
 
 	return cmdHandle, cmdData, config
 }
 
-// accessDB opens the database in either readwrite or readonly mode and passes
-// the instance to function fn. The database is closed and all resources
-// released when fn returns.
-//
-// The returned error may be from the database access or from fn, whichever
-// occurs first.
-func accessDB(readonly bool, fn func(*bolt.DB) error) (err error) {
-	db, err := bolt.Open(dbPath, 0600, &bolt.Options{ReadOnly: readonly, Timeout: 5 * time.Second})
-	if err != nil {
-		return err
+// parseArgsCmdTotp parses arguments specific to subcommand 'totp'. Returns the
+// handle for the external command whose TOTP code is printed.
+func parseArgsCmdTotp(args []string) (cmdHandle string) {
+	if len(args) != 1 {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: totp <cmd name>\n")
+		os.Exit(2)
 	}
-	defer func() {
-		if e := db.Close(); err == nil { // Return the first error encountered.
-			err = e
+	return args[0]
+}
+
+// parseArgsCmdTrash parses arguments specific to subcommand 'trash'. Returns
+// the action, either "list" or "empty", and for the latter the minimum age of
+// the deleted commands to remove, 0 for all.
+func parseArgsCmdTrash(args []string) (action string, olderThan time.Duration) {
+	flags := flag.NewFlagSet("trash empty", flag.ExitOnError)
+	flags.Var((*age)(&olderThan), "older-than", "Only remove cmds deleted longer ago than this `age`, e.g. 30d")
+
+	switch {
+	case len(args) == 1 && args[0] == "list":
+		return args[0], 0
+	case len(args) >= 1 && args[0] == "empty":
+		if err := flags.Parse(args[1:]); err == nil && flags.NArg() == 0 {
+			return args[0], olderThan
 		}
-	}()
+	}
 
-	return fn(db)
+	_, _ = fmt.Fprintf(os.Stderr, "Usage: trash list | trash empty [-older-than age]\n")
+	flags.PrintDefaults()
+	os.Exit(2)
+	return
 }
 
-// createBuckets creates the top-level buckets in db if they do not exist.
-func createBuckets(db *bolt.DB) error {
-	return db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists([]byte(commandBucketName))
-		if err == nil {
-			_, err = tx.CreateBucketIfNotExists([]byte(configBucketName))
-		}
-		return err
+// parseArgsCmdUndelete parses arguments specific to subcommand 'undelete'.
+// Returns the handle for the external command to be restored from the trash.
+func parseArgsCmdUndelete(args []string) (cmdHandle string) {
+	if len(args) != 1 {
+		_, _ = fmt.Fprintf(os.Stderr, "Usage: undelete <cmd name>\n")
+		os.Exit(2)
+	}
+	return args[0]
+}
+
+// openVault opens the vault at dbPath, which gets its passwords from the
+// user, see terminalPasswords.
+func openVault() (*vault.Vault, error) {
+	return vault.Open(dbPath, terminalPasswords{}, &vault.Options{
+		KDF:     userCfg.kdfParams(),
+		Timeout: time.Duration(userCfg.LockTimeout),
+		OnWait: func() {
+			_, _ = fmt.Fprintln(os.Stderr, "Waiting for the database, which is locked by another process ...")
+		},
+		Backend:      userCfg.Backend,
+		HistoryLimit: userCfg.HistoryLimit,
 	})
 }
 
+// terminalPasswords implements vault.PasswordProvider, asking the user for
+// passwords on the terminal or reading them from the configured password
+// source.
+type terminalPasswords struct{}
+
+// Password implements vault.PasswordProvider.
+func (terminalPasswords) Password(req *vault.PasswordRequest) ([]byte, error) {
+	switch req.Purpose {
+	case vault.AddedPassword:
+		return promptPassword("Enter new password: ", true)
+	case vault.RemovedPassword:
+		return promptPassword("Enter password to remove: ", false)
+	}
+	return requestPassword(req.Purpose == vault.NewPassword)
+}
+
 // requestPassword aks the user to enter a password once if repeat is false or
 // twice if repeat is true. Returns the password if all attempts are match.
+//
+// If a non-interactive password source is configured, the password is read
+// from it instead, see vault.ReadSecretSource.
 func requestPassword(repeat bool) ([]byte, error) {
+	if src := userCfg.PasswordSource; src != "" && src != "tty" {
+		return vault.ReadSecretSource(src)
+	}
+	return promptPassword("Enter password: ", repeat)
+}
+
+// promptPassword asks the user on the terminal to enter a password with the
+// given prompt once if repeat is false or twice if repeat is true. Returns the
+// password if all attempts are match.
+func promptPassword(prompt string, repeat bool) ([]byte, error) {
 	fd := int(os.Stdin.Fd())
 	state, err := terminal.GetState(fd)
 	if err != nil {
@@ -235,7 +778,7 @@ func requestPassword(repeat bool) ([]byte, error) {
 	defer close(interruptCh)
 	defer signal.Stop(interruptCh)
 
-	fmt.Print("Enter password: ")
+	fmt.Print(prompt)
 	pwd, err := terminal.ReadPassword(fd)
 	fmt.Println()
 	if err != nil {
@@ -0,0 +1,28 @@
+// This file implements subcommand 'migrate'.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// doCmdMigrate executes subcommand 'migrate', upgrading a DB written by an
+// older version to the current format after backing it up, see
+// vault.Vault.Upgrade.
+func doCmdMigrate() (err error) {
+	start := time.Now()
+	defer func() { recordAudit(migrateCommand, "", start, 0, err) }()
+
+	// Check if the DB exists.
+	if _, err := os.Stat(dbPath); err != nil {
+		return fmt.Errorf("cannot read database: %v", err)
+	}
+
+	upgraded, err := safe.Upgrade()
+	if err == nil && !upgraded {
+		fmt.Printf("%s is at the current format version already\n", dbPath)
+	}
+	return err
+}
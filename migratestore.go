@@ -0,0 +1,23 @@
+// This file implements subcommand 'migrate-store'.
+
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// doCmdMigrateStore executes subcommand 'migrate-store', copying all data of
+// the DB into a new store of the given backend at path. The DB in use is left
+// unchanged, it is up to the user to switch over to the new store.
+func doCmdMigrateStore(backend, path string) (err error) {
+	start := time.Now()
+	defer func() { recordAudit(migrateStoreCommand, path, start, 0, err) }()
+
+	if err := safe.CopyTo(path, backend); err != nil {
+		return err
+	}
+	fmt.Printf("Copied %s (%s) to %s (%s)\n", dbPath, safe.Backend(), path, backend)
+	fmt.Printf("Point the db setting or %s at the new store to use it\n", dbPathEnv)
+	return nil
+}
@@ -0,0 +1,158 @@
+// This file implements prompting for sensitive command data on save, so that
+// it never appears on the command line.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/aleist/cmdsafe/vault"
+)
+
+// promptPattern matches a placeholder {{prompt:<name>}} whose value is asked
+// for on save.
+var promptPattern = regexp.MustCompile(`\{\{prompt:([\w-]+)\}\}`)
+
+// secretMarker is entered in interactive mode for a value that is then asked
+// for without echo.
+const secretMarker = "!"
+
+// findPrompts returns the names of the {{prompt:<name>}} placeholders in the
+// arguments and environment values of cmdData, in order of appearance and
+// without duplicates.
+func findPrompts(cmdData *vault.Command) []string {
+	var names []string
+	seen := map[string]bool{}
+	_ = cmdData.MapValues(func(value string) (string, error) {
+		for _, m := range promptPattern.FindAllStringSubmatch(value, -1) {
+			if !seen[m[1]] {
+				seen[m[1]] = true
+				names = append(names, m[1])
+			}
+		}
+		return value, nil
+	})
+	return names
+}
+
+// fillPrompts asks for the value of each placeholder in names with echo
+// disabled and replaces the placeholders in cmdData with them, marking the
+// values as secret.
+func fillPrompts(cmdData *vault.Command, names []string) error {
+	values := map[string]string{}
+	for _, name := range names {
+		value, err := promptPassword(fmt.Sprintf("Enter secret %s: ", name), false)
+		if err != nil {
+			return err
+		}
+		values[name] = string(value)
+	}
+
+	return cmdData.MapSecretValues(func(value string) (string, error) {
+		return promptPattern.ReplaceAllStringFunc(value, func(m string) string {
+			return values[promptPattern.FindStringSubmatch(m)[1]]
+		}), nil
+	})
+}
+
+// promptCommand builds cmdData step by step, asking for its name unless set,
+// executable, arguments and environment variables on the terminal. Values
+// entered as "!" are asked for again with echo disabled and marked as secret.
+func promptCommand(cmdData *vault.Command) error {
+	in := bufio.NewReader(os.Stdin)
+	readLine := func(prompt string) (string, error) {
+		fmt.Print(prompt)
+		line, err := in.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+	readValue := func(prompt, secretPrompt string) (value string, secret bool, err error) {
+		value, err = readLine(prompt)
+		if err != nil || value != secretMarker {
+			return value, false, err
+		}
+		pwd, err := promptPassword(secretPrompt, false)
+		return string(pwd), true, err
+	}
+
+	var err error
+	for cmdData.Name == "" && err == nil {
+		cmdData.Name, err = readLine("Name: ")
+	}
+	for cmdData.Executable == "" && err == nil {
+		cmdData.Executable, err = readLine("Executable: ")
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Enter the arguments one per line, '" + secretMarker + "' for a secret and an empty line to finish.")
+	for i := 1; ; i++ {
+		arg, secret, err := readValue(fmt.Sprintf("Argument %d: ", i), fmt.Sprintf("Secret argument %d: ", i))
+		if err != nil {
+			return err
+		}
+		if arg == "" {
+			break
+		}
+		if secret {
+			cmdData.MarkSecretArg(len(cmdData.Args))
+		}
+		cmdData.Args = append(cmdData.Args, arg)
+	}
+
+	fmt.Println("Enter environment variables as name=value, name=" + secretMarker + " for a secret and an empty line to finish.")
+	for {
+		line, err := readLine("Environment variable: ")
+		if err != nil {
+			return err
+		}
+		if line == "" {
+			return nil
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			fmt.Println("Invalid environment variable, want name=value.")
+			continue
+		}
+		if parts[1] == secretMarker {
+			secret, err := promptPassword(fmt.Sprintf("Secret value of %s: ", parts[0]), false)
+			if err != nil {
+				return err
+			}
+			parts[1] = string(secret)
+			cmdData.MarkSecretEnv(parts[0])
+		}
+		if cmdData.Env == nil {
+			cmdData.Env = map[string]string{}
+		}
+		cmdData.Env[parts[0]] = parts[1]
+	}
+}
+
+// promptLine asks the user for a line of input with the given prompt. The
+// input is read a byte at a time, so that nothing beyond the line is taken
+// from stdin.
+func promptLine(prompt string) (string, error) {
+	fmt.Print(prompt)
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(b)
+		switch {
+		case n == 1 && b[0] == '\n', err == io.EOF && len(line) > 0:
+			return strings.TrimRight(string(line), "\r"), nil
+		case n == 1:
+			line = append(line, b[0])
+		case err != nil:
+			return "", err
+		}
+	}
+}
@@ -3,81 +3,103 @@
 package main
 
 import (
-	"crypto/rand"
-	"crypto/sha256"
 	"fmt"
+	"time"
 
-	"github.com/aleist/cmdsafe/crypto"
-	"github.com/boltdb/bolt"
-	"github.com/golang/protobuf/proto"
+	"github.com/aleist/cmdsafe/vault"
 )
 
 type saveOptions struct {
-	Replace bool // Replace existing value.
+	Replace     bool               // Replace existing value.
+	Tokens      []string           // Ask for access tokens of the secret resolvers for these schemes.
+	Generators  []*secretGenerator // Generate these secrets into their placeholders.
+	Show        bool               // Print the generated secrets once saved.
+	Clip        bool               // Copy the generated secret to the clipboard once saved.
+	Prompts     []string           // Ask for the values of these {{prompt:<name>}} placeholders.
+	Interactive bool               // Ask for the command data step by step.
 }
 
 // doCmdSave executes subcommand 'save', storing cmdData in encrypted form with
 // handle as its identifier.
-func doCmdSave(handle string, cmdData *Command, config *saveOptions) error {
-	pwd, err := requestPassword(true)
-	if err != nil {
-		return err
-	}
+func doCmdSave(handle string, cmdData *vault.Command, config *saveOptions) (err error) {
+	start := time.Now()
+	defer func() { recordAudit(saveCommand, handle, start, 0, err) }()
 
-	// Derive the crypto key from the password.
-	salt := make([]byte, 16)
-	if _, err := rand.Read(salt); err != nil {
-		return fmt.Errorf("failed to generate the random password salt: %v", err)
+	// Ask for the values that should not appear on the command line.
+	prompts := config.Prompts
+	if config.Interactive {
+		if err := promptCommand(cmdData); err != nil {
+			return err
+		}
+		handle = cmdData.Name
+		prompts = findPrompts(cmdData)
 	}
-	// Use default parameters from https://godoc.org/golang.org/x/crypto/scrypt
-	scryptConfig := &crypto.ScryptConfig{Salt: salt, N: 16384, R: 8, P: 1}
-	key, err := crypto.NewScryptKey(pwd, scryptConfig.Salt,
-		int(scryptConfig.N), int(scryptConfig.R), int(scryptConfig.P))
-	if err != nil {
+	if err := fillPrompts(cmdData, prompts); err != nil {
 		return err
 	}
 
-	// Encrypt the command data.
-	cryptoEnv, err := EncryptCommand(cmdData, key, crypto.EncryptAESCTR, sha256.New)
+	secrets, err := generateSecrets(cmdData, config.Generators)
 	if err != nil {
 		return err
 	}
-
-	// Add the user key data to the envelope.
-	cryptoEnv.UserKey = &crypto.UserKey{
-		Algorithm: crypto.KeyAlgo_SCRYPT,
-		Hash:      key.Hash(),
-		Scrypt:    scryptConfig,
+	if cmdData.Totp != nil && len(cmdData.Totp.Secret) == 0 {
+		seed, err := promptPassword("Enter TOTP secret (base32 or otpauth:// URI): ", false)
+		if err != nil {
+			return err
+		}
+		if err := parseTOTPSeed(string(seed), cmdData.Totp); err != nil {
+			return err
+		}
 	}
-
-	// Serialise the crypto envelope.
-	cryptoEnvMsg, err := proto.Marshal(cryptoEnv)
-	if err != nil {
-		return fmt.Errorf("failed to serialise the crypto envelope: %v", err)
+	if cmdData.UsesTOTP() && cmdData.Totp == nil {
+		return fmt.Errorf("%s requires a TOTP seed, see -totp", vault.TOTPPlaceholder)
 	}
-
-	// Write to DB.
-	return accessDB(false, writeCommand([]byte(handle), cryptoEnvMsg, config.Replace))
-}
-
-// writeCommand returns a closure that saves the command data value under key
-// handle in the DB.
-func writeCommand(handle, value []byte, replace bool) func(*bolt.DB) error {
-	return func(db *bolt.DB) error {
-		if err := createBuckets(db); err != nil {
+	for _, scheme := range config.Tokens {
+		if !vault.HasResolver(scheme) {
+			return fmt.Errorf("unknown secret reference scheme %q", scheme)
+		}
+		token, err := promptPassword(fmt.Sprintf("Enter %s token: ", scheme), false)
+		if err != nil {
 			return err
 		}
+		if cmdData.Tokens == nil {
+			cmdData.Tokens = map[string]string{}
+		}
+		cmdData.Tokens[scheme] = string(token)
+	}
 
-		return db.Update(func(tx *bolt.Tx) error {
-			cmdBucket := tx.Bucket([]byte(commandBucketName))
+	// Encrypt and write to DB.
+	if err := safe.Save(cmdData, config.Replace); err != nil {
+		if _, ok := err.(*vault.ExistsError); ok {
+			return fmt.Errorf("cannot replace existing entry for %s without -r flag", handle)
+		}
+		return err
+	}
 
-			// Check if entry already exists; only replace if explicitly requested.
-			old := cmdBucket.Get(handle)
-			if old != nil && !replace {
-				return fmt.Errorf("cannot replace existing entry for %s without -r flag", handle)
+	// Reveal the generated secrets if requested.
+	for _, gen := range config.Generators {
+		if config.Show {
+			fmt.Printf("%s: %s\n", gen.Name, secrets[gen.Name])
+		}
+		if config.Clip {
+			if err := copyToClipboard(secrets[gen.Name]); err != nil {
+				return fmt.Errorf("saved %s but %v", handle, err)
 			}
+		}
+	}
+	return nil
+}
 
-			return cmdBucket.Put(handle, value)
-		})
+// parseExpiry parses the expiry date s, either a date in the form YYYY-MM-DD,
+// which expires at its start in the local time zone, or an age from now, see
+// age.
+func parseExpiry(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	var d age
+	if err := d.Set(s); err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiry date %q, want YYYY-MM-DD or an age such as 90d", s)
 	}
+	return time.Now().Add(time.Duration(d)), nil
 }
@@ -0,0 +1,38 @@
+// This file implements subcommands 'share' and 'unshare'.
+
+package main
+
+import (
+	"time"
+)
+
+type shareOptions struct {
+	Password  bool   // Add or remove a password recipient.
+	PublicKey []byte // Add or remove the recipient with this X25519 public key.
+}
+
+// doCmdShare executes subcommand 'share', adding a recipient to the command
+// entry identified by handle, see vault.Vault.AddPassword and AddPublicKey.
+func doCmdShare(handle string, config *shareOptions) (err error) {
+	start := time.Now()
+	defer func() { recordAudit(shareCommand, handle, start, 0, err) }()
+
+	if config.Password {
+		return safe.AddPassword(handle)
+	}
+	return safe.AddPublicKey(handle, config.PublicKey)
+}
+
+// doCmdUnshare executes subcommand 'unshare', removing a recipient from the
+// command entry identified by handle. A password recipient is identified by
+// its password, the removal of a public key recipient has to be authorised
+// with the password of another recipient.
+func doCmdUnshare(handle string, config *shareOptions) (err error) {
+	start := time.Now()
+	defer func() { recordAudit(unshareCommand, handle, start, 0, err) }()
+
+	if config.Password {
+		return safe.RemovePassword(handle)
+	}
+	return safe.RemovePublicKey(handle, config.PublicKey)
+}
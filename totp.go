@@ -0,0 +1,83 @@
+// This file implements subcommand 'totp' and the parsing of TOTP seeds.
+
+package main
+
+import (
+	"encoding/base32"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aleist/cmdsafe/vault"
+)
+
+// doCmdTotp executes subcommand 'totp', printing the current TOTP code of the
+// command identified by handle.
+func doCmdTotp(handle string) (err error) {
+	start := time.Now()
+	defer func() { recordAudit(totpCommand, handle, start, 0, err) }()
+
+	cmdData, err := safe.Get(handle)
+	if err != nil {
+		return err
+	}
+	if cmdData.Totp == nil {
+		return fmt.Errorf("%s has no TOTP seed", handle)
+	}
+
+	code, err := cmdData.Totp.Code(time.Now())
+	if err != nil {
+		return err
+	}
+	fmt.Println(code)
+	return nil
+}
+
+// parseTOTPSeed sets the secret of seed from s, which is either the base32
+// encoded secret or an otpauth:// URI as used for QR codes. Parameters given in
+// the URI override those of seed.
+func parseTOTPSeed(s string, seed *vault.Totp) error {
+	secret := s
+	if strings.HasPrefix(s, "otpauth://") {
+		u, err := url.Parse(s)
+		if err != nil || u.Host != "totp" {
+			return fmt.Errorf("invalid otpauth URI, want otpauth://totp/...")
+		}
+		q := u.Query()
+		secret = q.Get("secret")
+		if v := q.Get("digits"); v != "" {
+			digits, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid TOTP digits %q", v)
+			}
+			seed.Digits = uint32(digits)
+		}
+		if v := q.Get("period"); v != "" {
+			period, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				return fmt.Errorf("invalid TOTP period %q", v)
+			}
+			seed.Period = uint32(period)
+		}
+		if v := q.Get("algorithm"); v != "" {
+			algo, ok := vault.Totp_Algorithm_value[strings.ToUpper(v)]
+			if !ok {
+				return fmt.Errorf("unsupported TOTP algorithm %q", v)
+			}
+			seed.Algorithm = vault.Totp_Algorithm(algo)
+		}
+	}
+
+	secret = strings.ToUpper(strings.Replace(secret, " ", "", -1))
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(secret, "="))
+	if err != nil || len(key) == 0 {
+		return fmt.Errorf("invalid TOTP secret, want base32 or an otpauth:// URI")
+	}
+	seed.Secret = key
+
+	// Check the parameters.
+	_, err = seed.Code(time.Now())
+	return err
+}
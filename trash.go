@@ -0,0 +1,96 @@
+// This file implements subcommand 'trash'.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trashOutput is the JSON form of a deleted command printed by subcommand
+// 'trash list'.
+type trashOutput struct {
+	Handle  string    `json:"handle"`
+	Deleted time.Time `json:"deleted"`
+}
+
+// doCmdTrash executes subcommand 'trash'. With action "list", it prints the
+// handles of the deleted commands in the trash and when they were deleted.
+// With action "empty", it permanently removes the commands deleted more than
+// olderThan ago, all of them if olderThan is 0.
+func doCmdTrash(action string, olderThan time.Duration) error {
+	// Check if the DB exists.
+	if _, err := os.Stat(dbPath); err != nil {
+		return fmt.Errorf("cannot read database: %v", err)
+	}
+
+	if action == "list" {
+		trashed := []trashOutput{}
+		err := safe.Trash(func(handle string, deleted time.Time) {
+			trashed = append(trashed, trashOutput{Handle: handle, Deleted: deleted})
+		})
+		if err != nil {
+			return err
+		}
+		return printOutput(trashed, func() {
+			for _, t := range trashed {
+				fmt.Printf("%s\t%s\n", t.Handle, t.Deleted.Format(time.RFC3339))
+			}
+		})
+	}
+
+	removed, err := emptyTrash(olderThan)
+	if err != nil || len(removed) == 0 {
+		return err
+	}
+	return autoCompact()
+}
+
+// emptyTrash implements action "empty" of doCmdTrash up to compacting the DB.
+// Returns the handles of the removed commands.
+func emptyTrash(olderThan time.Duration) (removed []string, err error) {
+	start := time.Now()
+	defer func() { recordAudit(trashCommand, "", start, 0, err) }()
+
+	removed, err = safe.EmptyTrash(olderThan)
+	if err == nil {
+		fmt.Printf("Removed %d deleted commands from the trash\n", len(removed))
+	}
+	return removed, err
+}
+
+// age is a flag.Value holding a duration, which in addition to the forms
+// accepted by time.ParseDuration can be given in days, e.g. "30d".
+type age time.Duration
+
+// String implements flag.Value.
+func (a *age) String() string {
+	if a == nil || *a == 0 {
+		return ""
+	}
+	if d := time.Duration(*a); d%(24*time.Hour) == 0 {
+		return strconv.FormatInt(int64(d/(24*time.Hour)), 10) + "d"
+	}
+	return time.Duration(*a).String()
+}
+
+// Set implements flag.Value.
+func (a *age) Set(s string) error {
+	if days := strings.TrimSuffix(s, "d"); days != s {
+		n, err := strconv.ParseUint(days, 10, 16)
+		if err != nil {
+			return fmt.Errorf("invalid number of days %q", days)
+		}
+		*a = age(time.Duration(n) * 24 * time.Hour)
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err == nil && d < 0 {
+		err = fmt.Errorf("negative duration %s", s)
+	}
+	*a = age(d)
+	return err
+}
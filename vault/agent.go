@@ -0,0 +1,481 @@
+// This file implements the agent, which serves the store of a vault to other
+// processes over a Unix socket.
+
+package vault
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// AgentSocket returns the path of the Unix socket an agent serving the DB at
+// path listens on.
+func AgentSocket(path string) string {
+	return path + ".sock"
+}
+
+// ServeAgent serves the DB of the vault on the Unix socket AgentSocket(Path())
+// until stop is closed or, if idle is non-zero, no client has used it for
+// that long.
+//
+// The agent keeps the DB open and runs the transactions of its clients one at
+// a time, so that many concurrent processes do not compete for the file lock.
+// Vaults opened on the same path use a running agent automatically, unless
+// Options.NoAgent is set. The agent only handles the encrypted entries, all
+// passwords and decryption stay with the clients.
+func (v *Vault) ServeAgent(idle time.Duration, stop <-chan struct{}) error {
+	socket := AgentSocket(v.path)
+	if agentRunning(v.path) {
+		return fmt.Errorf("an agent is serving %s already", v.path)
+	}
+
+	direct := *v
+	direct.opts.NoAgent = true
+	store, err := direct.openStore(false, v.opts.Timeout)
+	if err == errLocked {
+		err = &LockedError{Path: v.path, Timeout: v.opts.Timeout}
+	}
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	_ = os.Remove(socket) // Left behind by an agent that did not shut down.
+	l, err := listenAgent(socket)
+	if err != nil {
+		return err
+	}
+	defer l.Close() // Also removes the socket.
+	if err := os.Chmod(socket, 0600); err != nil {
+		return err
+	}
+
+	server := &agentServer{
+		store:      store,
+		sem:        make(chan struct{}, 1),
+		txTimeout:  v.opts.Timeout,
+		conns:      map[net.Conn]bool{},
+		lastActive: time.Now(),
+	}
+	go server.accept(l)
+	log.Printf("Agent serving %s on %s", v.path, socket)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for running := true; running; {
+		select {
+		case <-stop:
+			running = false
+		case <-ticker.C:
+			running = idle == 0 || !server.idle(idle)
+		}
+	}
+
+	// Let the running transaction finish, rolling it back if its client takes
+	// too long, and keep others from starting.
+	_ = l.Close()
+	select {
+	case server.sem <- struct{}{}:
+	case <-time.After(v.opts.Timeout):
+		server.closeConns()
+		server.sem <- struct{}{}
+	}
+	server.closeConns()
+	log.Printf("Agent for %s stopped", v.path)
+	return nil
+}
+
+// agentRunning returns whether an agent is serving the DB at path.
+func agentRunning(path string) bool {
+	socket := AgentSocket(path)
+	if info, err := os.Stat(socket); err != nil || info.Mode()&os.ModeSocket == 0 {
+		return false
+	}
+	conn, err := net.DialTimeout("unix", socket, time.Second)
+	if err != nil {
+		return false // The agent has not shut down cleanly.
+	}
+	_ = conn.Close()
+	return true
+}
+
+// agentOp is the operation of an agentRequest.
+type agentOp int
+
+// Agent operations.
+const (
+	agentBegin   agentOp = iota // Begin a transaction.
+	agentEnd                    // End the transaction.
+	agentGet                    // Tx.Get.
+	agentPut                    // Tx.Put.
+	agentDelete                 // Tx.Delete.
+	agentList                   // Tx.List with Key as the prefix.
+	agentBuckets                // Tx.Buckets.
+)
+
+// agentRequest is sent by a client to the agent, which replies with an
+// agentResponse. Both are gob encoded.
+type agentRequest struct {
+	Op       agentOp
+	Writable bool          // agentBegin: whether to begin a read-write transaction.
+	Timeout  time.Duration // agentBegin: how long to wait for other transactions.
+	Commit   bool          // agentEnd: whether to commit the transaction.
+	Bucket   string
+	Key      []byte
+	Value    []byte
+}
+
+// agentResponse is the reply of the agent to an agentRequest.
+type agentResponse struct {
+	Err       string         // The error message, empty on success.
+	Locked    bool           // The error is errLocked.
+	Conflict  *ConflictError // The error is a *ConflictError.
+	Integrity string         // The error is an *IntegrityError for this handle.
+	Found     bool           // agentGet: whether the key exists, gob omits empty values.
+	Value     []byte
+	Keys      [][]byte
+	Buckets   []string
+}
+
+// setErr stores err in the response.
+func (r *agentResponse) setErr(err error) {
+	switch e := err.(type) {
+	case nil:
+	case *ConflictError:
+		r.Conflict = e
+	case *IntegrityError:
+		r.Integrity, r.Err = e.Handle, e.Err.Error()
+	default:
+		r.Locked, r.Err = err == errLocked, err.Error()
+	}
+}
+
+// err returns the error stored in the response.
+func (r *agentResponse) err() error {
+	switch {
+	case r.Conflict != nil:
+		return r.Conflict
+	case r.Integrity != "":
+		return &IntegrityError{Handle: r.Integrity, Err: errors.New(r.Err)}
+	case r.Locked:
+		return errLocked
+	case r.Err != "":
+		return errors.New(r.Err)
+	}
+	return nil
+}
+
+// errAgentRollback ends a transaction of the agent without committing it.
+var errAgentRollback = errors.New("rolled back")
+
+// agentServer is the state of a running agent.
+type agentServer struct {
+	store     Store
+	sem       chan struct{} // Held while a transaction runs.
+	txTimeout time.Duration // How long a client may leave a transaction idle.
+
+	mu         sync.Mutex
+	conns      map[net.Conn]bool
+	lastActive time.Time
+}
+
+// accept serves the connections accepted from l until it is closed.
+func (s *agentServer) accept(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns[conn] = true
+		s.mu.Unlock()
+		go s.serve(conn)
+	}
+}
+
+// closeConns closes all client connections.
+func (s *agentServer) closeConns() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+}
+
+// idle returns whether no transaction runs and no request has been received
+// for the duration d.
+func (s *agentServer) idle(d time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sem) == 0 && time.Since(s.lastActive) >= d
+}
+
+// serve handles the requests received on conn until it is closed. A
+// transaction left open by the client is rolled back, as is one the client
+// sends no request in for s.txTimeout, so that a stalled client cannot block
+// all others.
+func (s *agentServer) serve(conn net.Conn) {
+	var tx *servedTx
+	defer func() {
+		if tx != nil {
+			_ = tx.end(false)
+		}
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+		_ = conn.Close()
+	}()
+
+	dec, enc := gob.NewDecoder(conn), gob.NewEncoder(conn)
+	for {
+		deadline := time.Time{}
+		if tx != nil {
+			deadline = time.Now().Add(s.txTimeout)
+		}
+		if err := conn.SetReadDeadline(deadline); err != nil {
+			return
+		}
+		req := &agentRequest{}
+		if err := dec.Decode(req); err != nil {
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				log.Printf("Rolled back a transaction left idle for %v", s.txTimeout)
+			}
+			return
+		}
+		s.mu.Lock()
+		s.lastActive = time.Now()
+		s.mu.Unlock()
+
+		resp := &agentResponse{}
+		var err error
+		switch {
+		case req.Op == agentBegin && tx == nil:
+			tx, err = s.begin(req.Writable, req.Timeout)
+		case req.Op == agentBegin:
+			err = fmt.Errorf("a transaction is running already")
+		case tx == nil:
+			err = fmt.Errorf("no transaction is running")
+		case req.Op == agentEnd:
+			err = tx.end(req.Commit)
+			tx = nil
+		default:
+			err = tx.do(func(t Tx) error {
+				return req.apply(t, resp)
+			})
+		}
+		resp.setErr(err)
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+// apply runs the operation of the request in tx, storing its results in resp.
+func (req *agentRequest) apply(tx Tx, resp *agentResponse) (err error) {
+	switch req.Op {
+	case agentGet:
+		resp.Value, err = tx.Get(req.Bucket, req.Key)
+		resp.Found = resp.Value != nil
+	case agentPut:
+		err = tx.Put(req.Bucket, req.Key, req.Value)
+	case agentDelete:
+		err = tx.Delete(req.Bucket, req.Key)
+	case agentList:
+		resp.Keys, err = tx.List(req.Bucket, req.Key)
+	case agentBuckets:
+		resp.Buckets, err = tx.Buckets()
+	default:
+		err = fmt.Errorf("unknown agent operation %d", req.Op)
+	}
+	return err
+}
+
+// servedTx is a transaction run by the agent for a client. The store
+// transaction runs in its own goroutine, which executes the operations sent
+// to it.
+type servedTx struct {
+	ops      chan func(tx Tx) error // The operations to run, nil to commit.
+	results  chan error
+	finished chan struct{} // Closed when the transaction has ended.
+	err      error         // The result of the transaction, once finished.
+}
+
+// begin starts a transaction once the running one has ended, waiting up to
+// timeout. Returns errLocked on timeout.
+func (s *agentServer) begin(writable bool, timeout time.Duration) (*servedTx, error) {
+	select {
+	case s.sem <- struct{}{}:
+	case <-time.After(timeout):
+		return nil, errLocked
+	}
+
+	t := &servedTx{
+		ops:      make(chan func(tx Tx) error),
+		results:  make(chan error),
+		finished: make(chan struct{}),
+	}
+	run := s.store.View
+	if writable {
+		run = s.store.Update
+	}
+	go func() {
+		t.err = run(func(tx Tx) error {
+			for op := range t.ops {
+				if op == nil {
+					return nil
+				}
+				t.results <- op(tx)
+			}
+			return errAgentRollback
+		})
+		close(t.finished)
+		<-s.sem
+	}()
+	return t, nil
+}
+
+// do runs op in the transaction.
+func (t *servedTx) do(op func(tx Tx) error) error {
+	select {
+	case t.ops <- op:
+		return <-t.results
+	case <-t.finished:
+		return t.err // The transaction failed to begin.
+	}
+}
+
+// end commits or rolls back the transaction and waits for it to finish.
+func (t *servedTx) end(commit bool) error {
+	if commit {
+		select {
+		case t.ops <- nil:
+		case <-t.finished:
+		}
+	} else {
+		close(t.ops)
+	}
+	<-t.finished
+	if t.err == errAgentRollback {
+		return nil
+	}
+	return t.err
+}
+
+// agentStore is a Store accessed through an agent.
+type agentStore struct {
+	conn     net.Conn
+	enc      *gob.Encoder
+	dec      *gob.Decoder
+	readonly bool
+	timeout  time.Duration
+}
+
+func openAgentStore(path string, readonly bool, timeout time.Duration) (Store, error) {
+	conn, err := net.DialTimeout("unix", AgentSocket(path), timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the agent: %v", err)
+	}
+	return &agentStore{
+		conn:     conn,
+		enc:      gob.NewEncoder(conn),
+		dec:      gob.NewDecoder(conn),
+		readonly: readonly,
+		timeout:  timeout,
+	}, nil
+}
+
+// View implements Store.
+func (s *agentStore) View(fn func(tx Tx) error) error {
+	return s.run(false, fn)
+}
+
+// Update implements Store.
+func (s *agentStore) Update(fn func(tx Tx) error) error {
+	if s.readonly {
+		return fmt.Errorf("cannot update a read-only store")
+	}
+	return s.run(true, fn)
+}
+
+// Close implements Store.
+func (s *agentStore) Close() error {
+	return s.conn.Close()
+}
+
+// run calls fn in a transaction of the agent.
+func (s *agentStore) run(writable bool, fn func(tx Tx) error) error {
+	if _, err := s.call(&agentRequest{Op: agentBegin, Writable: writable, Timeout: s.timeout}); err != nil {
+		return err
+	}
+	err := fn(agentTx{s})
+	_, endErr := s.call(&agentRequest{Op: agentEnd, Commit: writable && err == nil})
+	if err == nil {
+		err = endErr
+	}
+	return err
+}
+
+// call sends req to the agent and returns its response.
+func (s *agentStore) call(req *agentRequest) (*agentResponse, error) {
+	if err := s.enc.Encode(req); err != nil {
+		return nil, fmt.Errorf("failed to send a request to the agent: %v", err)
+	}
+	resp := &agentResponse{}
+	if err := s.dec.Decode(resp); err != nil {
+		return nil, fmt.Errorf("failed to receive a response from the agent: %v", err)
+	}
+	return resp, resp.err()
+}
+
+// agentTx is a Tx of an agentStore.
+type agentTx struct {
+	store *agentStore
+}
+
+// Get implements Tx.
+func (t agentTx) Get(bucket string, key []byte) ([]byte, error) {
+	resp, err := t.store.call(&agentRequest{Op: agentGet, Bucket: bucket, Key: key})
+	if err != nil || !resp.Found {
+		return nil, err
+	}
+	if resp.Value == nil {
+		return []byte{}, nil
+	}
+	return resp.Value, nil
+}
+
+// Put implements Tx.
+func (t agentTx) Put(bucket string, key, value []byte) error {
+	_, err := t.store.call(&agentRequest{Op: agentPut, Bucket: bucket, Key: key, Value: value})
+	return err
+}
+
+// Delete implements Tx.
+func (t agentTx) Delete(bucket string, key []byte) error {
+	_, err := t.store.call(&agentRequest{Op: agentDelete, Bucket: bucket, Key: key})
+	return err
+}
+
+// List implements Tx.
+func (t agentTx) List(bucket string, prefix []byte) ([][]byte, error) {
+	resp, err := t.store.call(&agentRequest{Op: agentList, Bucket: bucket, Key: prefix})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Keys, nil
+}
+
+// Buckets implements Tx.
+func (t agentTx) Buckets() ([]string, error) {
+	resp, err := t.store.call(&agentRequest{Op: agentBuckets})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Buckets, nil
+}
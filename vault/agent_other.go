@@ -0,0 +1,14 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package vault
+
+import (
+	"net"
+)
+
+// listenAgent listens on the Unix socket at path. There is no umask on this
+// platform, the socket is restricted to its owner by ServeAgent afterwards.
+func listenAgent(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
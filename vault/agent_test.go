@@ -0,0 +1,119 @@
+package vault
+
+import (
+	"encoding/gob"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// startTestAgent starts an agent on a new bolt DB in a temporary directory,
+// rolling back transactions idle for longer than timeout. Returns the socket
+// path and a function stopping the agent and removing the DB.
+func startTestAgent(t *testing.T, timeout time.Duration) (string, func()) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("the agent needs flock")
+	}
+	dir, err := ioutil.TempDir("", "cmdsafe-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "vault.db")
+	v, err := Open(path, nil, &Options{Timeout: timeout})
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	stop, done := make(chan struct{}), make(chan error, 1)
+	go func() { done <- v.ServeAgent(0, stop) }()
+	socket := AgentSocket(path)
+	for i := 0; !agentRunning(path); i++ {
+		if i == 100 {
+			close(stop)
+			_ = os.RemoveAll(dir)
+			t.Fatalf("the agent did not start: %v", <-done)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return socket, func() {
+		close(stop)
+		if err := <-done; err != nil {
+			t.Errorf("ServeAgent: %v", err)
+		}
+		_ = os.RemoveAll(dir)
+	}
+}
+
+// testAgentClient is a raw connection to an agent.
+type testAgentClient struct {
+	net.Conn
+	enc *gob.Encoder
+	dec *gob.Decoder
+}
+
+func dialTestAgent(t *testing.T, socket string) *testAgentClient {
+	t.Helper()
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testAgentClient{Conn: conn, enc: gob.NewEncoder(conn), dec: gob.NewDecoder(conn)}
+}
+
+// call sends req to the agent and returns its response.
+func (c *testAgentClient) call(t *testing.T, req *agentRequest) *agentResponse {
+	t.Helper()
+	if err := c.enc.Encode(req); err != nil {
+		t.Fatal(err)
+	}
+	resp := &agentResponse{}
+	if err := c.dec.Decode(resp); err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestAgentSocketPermissions(t *testing.T) {
+	socket, stop := startTestAgent(t, time.Second)
+	defer stop()
+
+	info, err := os.Stat(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		t.Errorf("the agent socket has the permissions %v, want none for group and others", perm)
+	}
+}
+
+func TestAgentStalledTransaction(t *testing.T) {
+	socket, stop := startTestAgent(t, 200*time.Millisecond)
+	defer stop()
+
+	// A client that begins a transaction and then stalls without closing.
+	stalled := dialTestAgent(t, socket)
+	defer stalled.Close()
+	if resp := stalled.call(t, &agentRequest{Op: agentBegin, Writable: true, Timeout: time.Second}); resp.err() != nil {
+		t.Fatalf("begin: %v", resp.err())
+	}
+
+	// Another client gets its turn once the stalled transaction is rolled back.
+	conn := dialTestAgent(t, socket)
+	defer conn.Close()
+	start := time.Now()
+	if resp := conn.call(t, &agentRequest{Op: agentBegin, Writable: true, Timeout: 5 * time.Second}); resp.err() != nil {
+		t.Fatalf("begin after a stalled client: %v", resp.err())
+	}
+	if waited := time.Since(start); waited > 2*time.Second {
+		t.Errorf("waited %v for a stalled transaction, want about 200ms", waited)
+	}
+	if resp := conn.call(t, &agentRequest{Op: agentEnd, Commit: true}); resp.err() != nil {
+		t.Errorf("end: %v", resp.err())
+	}
+}
@@ -0,0 +1,17 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package vault
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenAgent listens on the Unix socket at path, which is created accessible
+// by the owner only, so that other users cannot connect in the meantime.
+func listenAgent(path string) (net.Listener, error) {
+	mask := syscall.Umask(0077)
+	defer syscall.Umask(mask)
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,65 @@
+//go:build linux
+// +build linux
+
+package vault
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// newArgScrubber returns a function that overwrites the arguments of process
+// pid in its memory with zeros, skipping the first skip bytes (argv[0] and its
+// terminator). The process must be a child of the current one.
+//
+// The memory is opened immediately, so the returned function cannot affect a
+// different process even if pid is reused in the meantime. It releases all
+// resources and must be called exactly once.
+func newArgScrubber(pid, skip int) (func() error, error) {
+	start, end, err := argRange(pid)
+	if err != nil {
+		return nil, err
+	}
+	mem, err := os.OpenFile(fmt.Sprintf("/proc/%d/mem", pid), os.O_WRONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		defer mem.Close()
+		if end-start <= uint64(skip) {
+			return nil // No arguments.
+		}
+		_, err := mem.WriteAt(make([]byte, end-start-uint64(skip)), int64(start)+int64(skip))
+		return err
+	}, nil
+}
+
+// argRange returns the address range of the arguments of process pid, see
+// arg_start and arg_end in proc(5).
+func argRange(pid int) (start, end uint64, err error) {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// The second field, the executable name in parentheses, may contain
+	// spaces. The fields following it start with the third, state.
+	i := strings.LastIndexByte(string(stat), ')')
+	fields := strings.Fields(string(stat[i+1:]))
+	const argStartField, argEndField = 48 - 3, 49 - 3
+	if i < 0 || len(fields) <= argEndField {
+		return 0, 0, fmt.Errorf("unexpected format of /proc/%d/stat", pid)
+	}
+
+	if start, err = strconv.ParseUint(fields[argStartField], 10, 64); err == nil {
+		end, err = strconv.ParseUint(fields[argEndField], 10, 64)
+	}
+	if err != nil || start == 0 || end < start {
+		return 0, 0, fmt.Errorf("cannot determine the argument memory of process %d", pid)
+	}
+	return start, end, nil
+}
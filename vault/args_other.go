@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package vault
+
+import "fmt"
+
+// newArgScrubber is not supported on this platform.
+func newArgScrubber(pid, skip int) (func() error, error) {
+	return nil, fmt.Errorf("argument scrubbing is only supported on Linux")
+}
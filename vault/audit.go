@@ -0,0 +1,173 @@
+// This file implements the audit log.
+
+package vault
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Keys in the config bucket describing the end of the audit log.
+const (
+	// auditHeadKey holds the hash of the latest audit record, so that removing
+	// records from the end of the log is detected.
+	auditHeadKey = "audit-head"
+	// auditSeqKey holds the sequence number of the latest audit record, so
+	// that appending a record doesn't need to list the log.
+	auditSeqKey = "audit-seq"
+)
+
+// AuditLog calls fn with each record of the audit log and its sequence number
+// in order, verifying the integrity of the hash chain on the way. Returns an
+// error once a record fails verification, or if records have been removed
+// from the log. The records are numbered consecutively from 1, up to the
+// number kept under auditSeqKey.
+//
+// The chain uses plain SHA-256 hashes, no key. It detects accidental damage
+// and careless edits, but anyone able to write the database can rewrite the
+// whole log and its head consistently.
+func (v *Vault) AuditLog(fn func(seq uint64, record *AuditRecord)) error {
+	return v.view(func(tx Tx) error {
+		keys, err := tx.List(auditBucketName, nil)
+		if err != nil {
+			return err
+		}
+
+		var prevHash []byte
+		for i, k := range keys {
+			if len(k) != 8 {
+				return fmt.Errorf("invalid audit record key %q, the log has been tampered with", k)
+			}
+			seq := binary.BigEndian.Uint64(k)
+			if seq != uint64(i+1) {
+				return fmt.Errorf("audit record %d: found record %d, the log has been tampered with", i+1, seq)
+			}
+			val, err := tx.Get(auditBucketName, k)
+			if err != nil {
+				return err
+			}
+			record := &AuditRecord{}
+			if err := proto.Unmarshal(val, record); err != nil {
+				return fmt.Errorf("audit record %d: failed to deserialise: %v", seq, err)
+			}
+			if !bytes.Equal(record.PrevHash, prevHash) {
+				return fmt.Errorf("audit record %d: hash chain broken, the log has been tampered with", seq)
+			}
+			fn(seq, record)
+
+			sum := sha256.Sum256(val)
+			prevHash = sum[:]
+		}
+
+		head, err := tx.Get(configBucketName, []byte(auditHeadKey))
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(head, prevHash) {
+			return fmt.Errorf("audit log head mismatch, records have been removed")
+		}
+		last, err := tx.Get(configBucketName, []byte(auditSeqKey))
+		if err != nil {
+			return err
+		}
+		if last != nil || len(keys) > 0 {
+			if len(last) != 8 || binary.BigEndian.Uint64(last) != uint64(len(keys)) {
+				return fmt.Errorf("audit log sequence number mismatch, records have been removed")
+			}
+		}
+		return nil
+	})
+}
+
+// RecordAudit appends a record of operation op having been executed on handle
+// to the audit log. The operation started at start and finished with the
+// given exit status and error. A non-zero status is implied by err. The vault
+// does not record its operations itself, this is left to the application,
+// e.g. the cmdsafe tool records its subcommands.
+//
+// Failure to write the record is only logged, so as not to change the outcome
+// of the operation. Nothing is recorded if the store does not exist.
+func (v *Vault) RecordAudit(op, handle string, start time.Time, status int, err error) {
+	v.RecordAuditReason(op, handle, "", start, status, err)
+}
+
+// RecordAuditReason is RecordAudit for an operation given a reason, such as
+// running a command whose policy requires one, see RunOptions.Reason.
+func (v *Vault) RecordAuditReason(op, handle, reason string, start time.Time, status int, err error) {
+	if _, e := os.Stat(v.path); e != nil {
+		return
+	}
+
+	record := &AuditRecord{
+		Time:       start.UnixNano(),
+		Subcommand: op,
+		Handle:     handle,
+		Status:     int32(status),
+		Duration:   int64(time.Since(start)),
+		Reason:     reason,
+	}
+	if err != nil {
+		record.Error = err.Error()
+		if status == 0 {
+			record.Status = 1
+		}
+	}
+	if u, e := user.Current(); e == nil {
+		record.User = u.Username
+	} else {
+		record.User = strconv.Itoa(os.Getuid())
+	}
+	record.Hostname, _ = os.Hostname()
+
+	if e := v.update(appendAuditRecord(record)); e != nil {
+		log.Print("Warning: failed to write the audit log: ", e)
+	}
+}
+
+// appendAuditRecord returns a closure that chains record to the latest record
+// in the audit log and appends it under the next sequence number, starting
+// from 1.
+func appendAuditRecord(record *AuditRecord) func(tx Tx) error {
+	return func(tx Tx) error {
+		var err error
+		record.PrevHash, err = tx.Get(configBucketName, []byte(auditHeadKey))
+		if err != nil {
+			return err
+		}
+		value, err := proto.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to serialise the audit record: %v", err)
+		}
+
+		last, err := tx.Get(configBucketName, []byte(auditSeqKey))
+		if err != nil {
+			return err
+		}
+		var seq uint64 = 1
+		if len(last) == 8 {
+			seq = binary.BigEndian.Uint64(last) + 1
+		} else if last != nil {
+			return fmt.Errorf("invalid audit log sequence number")
+		}
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		if err := tx.Put(auditBucketName, key, value); err != nil {
+			return err
+		}
+		if err := tx.Put(configBucketName, []byte(auditSeqKey), key); err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(value)
+		return tx.Put(configBucketName, []byte(auditHeadKey), sum[:])
+	}
+}
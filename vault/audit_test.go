@@ -0,0 +1,123 @@
+package vault
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestAuditVault returns a vault on a new dir store in a temporary
+// directory whose audit log holds records for ops, and a function removing it.
+func newTestAuditVault(t *testing.T, ops ...string) (*Vault, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "cmdsafe-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := Open(filepath.Join(dir, "vault.db"), nil, &Options{Backend: "dir", Timeout: time.Second})
+	if err == nil {
+		err = v.update(func(tx Tx) error { return nil })
+	}
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	for _, op := range ops {
+		v.RecordAudit(op, "server1", time.Now(), 0, nil)
+	}
+	return v, func() { _ = os.RemoveAll(dir) }
+}
+
+// auditKey returns the audit log key of the record seq.
+func auditKey(seq uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, seq)
+	return key
+}
+
+func TestAuditSequence(t *testing.T) {
+	v, cleanup := newTestAuditVault(t, "save", "run", "print", "delete")
+	defer cleanup()
+
+	var ops []string
+	err := v.AuditLog(func(seq uint64, record *AuditRecord) {
+		if seq != uint64(len(ops)+1) {
+			t.Errorf("record %q has the sequence number %d, want %d", record.Subcommand, seq, len(ops)+1)
+		}
+		ops = append(ops, record.Subcommand)
+	})
+	if err != nil {
+		t.Fatalf("AuditLog: %v", err)
+	}
+	if strings.Join(ops, " ") != "save run print delete" {
+		t.Errorf("AuditLog returned %q, want save, run, print and delete", ops)
+	}
+
+	err = v.view(func(tx Tx) error {
+		last, err := tx.Get(configBucketName, []byte(auditSeqKey))
+		if err == nil && (len(last) != 8 || binary.BigEndian.Uint64(last) != 4) {
+			t.Errorf("the latest sequence number is %x, want 4", last)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuditTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(v *Vault) error
+		want   string
+	}{
+		{
+			name: "stray file",
+			tamper: func(v *Vault) error {
+				return ioutil.WriteFile(filepath.Join(v.path, auditBucketName, "stray"), nil, 0600)
+			},
+			want: "tampered",
+		},
+		{
+			name: "middle record removed",
+			tamper: func(v *Vault) error {
+				return v.update(func(tx Tx) error { return tx.Delete(auditBucketName, auditKey(2)) })
+			},
+			want: "tampered",
+		},
+		{
+			name: "tail record removed with the head rewritten",
+			tamper: func(v *Vault) error {
+				return v.update(func(tx Tx) error {
+					value, err := tx.Get(auditBucketName, auditKey(2))
+					if err != nil {
+						return err
+					}
+					sum := sha256.Sum256(value)
+					if err := tx.Put(configBucketName, []byte(auditHeadKey), sum[:]); err != nil {
+						return err
+					}
+					return tx.Delete(auditBucketName, auditKey(3))
+				})
+			},
+			want: "records have been removed",
+		},
+	}
+	for _, tt := range tests {
+		v, cleanup := newTestAuditVault(t, "save", "run", "print")
+		if err := tt.tamper(v); err != nil {
+			cleanup()
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		err := v.AuditLog(func(seq uint64, record *AuditRecord) {})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: AuditLog = %v, want an error containing %q", tt.name, err, tt.want)
+		}
+		cleanup()
+	}
+}
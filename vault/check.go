@@ -0,0 +1,131 @@
+// This file implements checking the integrity of the stored commands.
+
+package vault
+
+import (
+	"github.com/aleist/cmdsafe/crypto"
+)
+
+// CheckReport is the result of Check.
+type CheckReport struct {
+	Checked   int               // The number of entries checked.
+	Decrypted []string          // The handles of the entries decrypted, if requested.
+	Broken    []*IntegrityError // The broken entries, ordered by handle.
+	Conflicts []*ConflictError  // The entries with conflicting edits in a git store.
+}
+
+// Check checks the integrity of all stored command entries.
+//
+// Every entry is checked for structural validity. If decrypt is set, a
+// password is asked from the password provider and the entries it matches are
+// also decrypted to verify their HMAC and name. Entries saved with a different
+// password cannot be verified further, but if the password matches none of the
+// entries, ErrIncorrectPassword is returned. Entries of a git store with
+// conflicting edits are reported separately, they cannot be checked until
+// resolved.
+func (v *Vault) Check(decrypt bool) (*CheckReport, error) {
+	var pwd []byte
+	if decrypt {
+		var err error
+		if pwd, err = v.password("", UnlockPassword); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := v.loadAllCommandData()
+	if err != nil {
+		return nil, err
+	}
+
+	report := &CheckReport{Checked: len(entries)}
+	mismatched := 0
+	for _, e := range entries {
+		if conflict, ok := e.err.(*ConflictError); ok {
+			report.Conflicts = append(report.Conflicts, conflict)
+			continue
+		}
+		cryptoEnv, err := e.envelope()
+		if err == nil && pwd != nil {
+			_, err = v.decryptCommandData(e.handle, cryptoEnv, pwd)
+			if err == ErrIncorrectPassword {
+				mismatched++
+				continue
+			}
+			report.Decrypted = append(report.Decrypted, e.handle)
+		}
+		if err != nil {
+			integrityErr, ok := err.(*IntegrityError)
+			if !ok {
+				integrityErr = &IntegrityError{Handle: e.handle, Err: err}
+			}
+			report.Broken = append(report.Broken, integrityErr)
+		}
+	}
+	if mismatched > 0 && len(report.Decrypted) == 0 {
+		return nil, ErrIncorrectPassword
+	}
+	return report, nil
+}
+
+// Quarantine moves the entries for handles out of the way into the quarantine
+// bucket, replacing any entries of the same name quarantined previously.
+func (v *Vault) Quarantine(handles []string) error {
+	return v.update(func(tx Tx) error {
+		for _, handle := range handles {
+			value, err := tx.Get(commandBucketName, []byte(handle))
+			if err != nil {
+				return err
+			}
+			if value == nil {
+				continue // Deleted concurrently.
+			}
+			if err := tx.Put(quarantineBucketName, []byte(handle), value); err != nil {
+				return err
+			}
+			if err := tx.Delete(commandBucketName, []byte(handle)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// commandEntry is a raw key/value pair from the command bucket.
+type commandEntry struct {
+	handle string
+	value  []byte
+	err    error // A *ConflictError or *IntegrityError from loading the value.
+}
+
+// envelope returns the crypto envelope of the entry.
+func (e *commandEntry) envelope() (*crypto.CryptoEnvelope, error) {
+	if e.err != nil {
+		return nil, e.err
+	}
+	return unmarshalEnvelope(e.handle, e.value)
+}
+
+// loadAllCommandData loads the unprocessed data of all command entries. Entries
+// failing to load because they are broken or conflicting are returned with the
+// error.
+func (v *Vault) loadAllCommandData() ([]commandEntry, error) {
+	var entries []commandEntry
+	err := v.view(func(tx Tx) error {
+		keys, err := tx.List(commandBucketName, nil)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			val, err := tx.Get(commandBucketName, k)
+			switch err.(type) {
+			case nil, *ConflictError, *IntegrityError:
+			default:
+				return err
+			}
+			entries = append(entries, commandEntry{string(k), val, err})
+		}
+		return nil
+	})
+
+	return entries, err
+}
@@ -0,0 +1,26 @@
+package vault
+
+import (
+	"testing"
+)
+
+func TestCheckPassword(t *testing.T) {
+	passwords := map[PasswordPurpose]string{}
+	var onAdded func()
+	v, cleanup := newTestShareVault(t, passwords, &onAdded)
+	defer cleanup()
+
+	passwords[UnlockPassword] = "wrong"
+	if report, err := v.Check(true); err != ErrIncorrectPassword {
+		t.Errorf("Check with a wrong password = %+v, %v, want ErrIncorrectPassword", report, err)
+	}
+
+	passwords[UnlockPassword] = "owner"
+	report, err := v.Check(true)
+	if err != nil || len(report.Decrypted) != 1 || len(report.Broken) != 0 {
+		t.Errorf("Check with the password = %+v, %v, want server1 decrypted", report, err)
+	}
+	if report, err := v.Check(false); err != nil || report.Checked != 1 || report.Decrypted != nil {
+		t.Errorf("Check without decrypting = %+v, %v, want 1 entry checked", report, err)
+	}
+}
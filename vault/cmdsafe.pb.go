@@ -0,0 +1,511 @@
+// Code generated by protoc-gen-go.
+// source: cmdsafe.proto
+// DO NOT EDIT!
+
+/*
+Package vault is a generated protocol buffer package.
+
+It is generated from these files:
+	cmdsafe.proto
+
+It has these top-level messages:
+	Command
+	Policy
+	Totp
+	Sandbox
+	ArgScrub
+	AuditRecord
+	Identity
+	Revision
+*/
+package vault
+
+import proto "github.com/golang/protobuf/proto"
+import fmt "fmt"
+import math "math"
+
+// Reference imports to suppress errors if they are not otherwise used.
+var _ = proto.Marshal
+var _ = fmt.Errorf
+var _ = math.Inf
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the proto package it is being compiled against.
+// A compilation error at this line likely means your copy of the
+// proto package needs to be updated.
+const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
+
+type Totp_Algorithm int32
+
+const (
+	Totp_SHA1   Totp_Algorithm = 0
+	Totp_SHA256 Totp_Algorithm = 1
+	Totp_SHA512 Totp_Algorithm = 2
+)
+
+var Totp_Algorithm_name = map[int32]string{
+	0: "SHA1",
+	1: "SHA256",
+	2: "SHA512",
+}
+var Totp_Algorithm_value = map[string]int32{
+	"SHA1":   0,
+	"SHA256": 1,
+	"SHA512": 2,
+}
+
+func (x Totp_Algorithm) String() string {
+	return proto.EnumName(Totp_Algorithm_name, int32(x))
+}
+func (Totp_Algorithm) EnumDescriptor() ([]byte, []int) { return fileDescriptor0, []int{2, 0} }
+
+type Command struct {
+	Name       string            `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	Executable string            `protobuf:"bytes,2,opt,name=executable" json:"executable,omitempty"`
+	Args       []string          `protobuf:"bytes,3,rep,name=args" json:"args,omitempty"`
+	Sandbox    *Sandbox          `protobuf:"bytes,4,opt,name=sandbox" json:"sandbox,omitempty"`
+	ArgScrub   *ArgScrub         `protobuf:"bytes,5,opt,name=arg_scrub,json=argScrub" json:"arg_scrub,omitempty"`
+	Env        map[string]string `protobuf:"bytes,6,rep,name=env" json:"env,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Tokens     map[string]string `protobuf:"bytes,7,rep,name=tokens" json:"tokens,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Totp       *Totp             `protobuf:"bytes,8,opt,name=totp" json:"totp,omitempty"`
+	Expires    int64             `protobuf:"varint,9,opt,name=expires" json:"expires,omitempty"`
+	Policy     *Policy           `protobuf:"bytes,10,opt,name=policy" json:"policy,omitempty"`
+	SecretArgs []uint32          `protobuf:"varint,11,rep,packed,name=secret_args,json=secretArgs" json:"secret_args,omitempty"`
+	SecretEnv  []string          `protobuf:"bytes,12,rep,name=secret_env,json=secretEnv" json:"secret_env,omitempty"`
+}
+
+func (m *Command) Reset()                    { *m = Command{} }
+func (m *Command) String() string            { return proto.CompactTextString(m) }
+func (*Command) ProtoMessage()               {}
+func (*Command) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+
+func (m *Command) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Command) GetExecutable() string {
+	if m != nil {
+		return m.Executable
+	}
+	return ""
+}
+
+func (m *Command) GetArgs() []string {
+	if m != nil {
+		return m.Args
+	}
+	return nil
+}
+
+func (m *Command) GetSandbox() *Sandbox {
+	if m != nil {
+		return m.Sandbox
+	}
+	return nil
+}
+
+func (m *Command) GetArgScrub() *ArgScrub {
+	if m != nil {
+		return m.ArgScrub
+	}
+	return nil
+}
+
+func (m *Command) GetEnv() map[string]string {
+	if m != nil {
+		return m.Env
+	}
+	return nil
+}
+
+func (m *Command) GetTokens() map[string]string {
+	if m != nil {
+		return m.Tokens
+	}
+	return nil
+}
+
+func (m *Command) GetTotp() *Totp {
+	if m != nil {
+		return m.Totp
+	}
+	return nil
+}
+
+func (m *Command) GetExpires() int64 {
+	if m != nil {
+		return m.Expires
+	}
+	return 0
+}
+
+func (m *Command) GetPolicy() *Policy {
+	if m != nil {
+		return m.Policy
+	}
+	return nil
+}
+
+func (m *Command) GetSecretArgs() []uint32 {
+	if m != nil {
+		return m.SecretArgs
+	}
+	return nil
+}
+
+func (m *Command) GetSecretEnv() []string {
+	if m != nil {
+		return m.SecretEnv
+	}
+	return nil
+}
+
+// Guards checked before a command is run, before its data is decrypted.
+type Policy struct {
+	RequireConfirm bool   `protobuf:"varint,1,opt,name=require_confirm,json=requireConfirm" json:"require_confirm,omitempty"`
+	AllowHours     string `protobuf:"bytes,2,opt,name=allow_hours,json=allowHours" json:"allow_hours,omitempty"`
+	RequireReason  bool   `protobuf:"varint,3,opt,name=require_reason,json=requireReason" json:"require_reason,omitempty"`
+	RequireTty     bool   `protobuf:"varint,4,opt,name=require_tty,json=requireTty" json:"require_tty,omitempty"`
+}
+
+func (m *Policy) Reset()                    { *m = Policy{} }
+func (m *Policy) String() string            { return proto.CompactTextString(m) }
+func (*Policy) ProtoMessage()               {}
+func (*Policy) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+
+func (m *Policy) GetRequireConfirm() bool {
+	if m != nil {
+		return m.RequireConfirm
+	}
+	return false
+}
+
+func (m *Policy) GetAllowHours() string {
+	if m != nil {
+		return m.AllowHours
+	}
+	return ""
+}
+
+func (m *Policy) GetRequireReason() bool {
+	if m != nil {
+		return m.RequireReason
+	}
+	return false
+}
+
+func (m *Policy) GetRequireTty() bool {
+	if m != nil {
+		return m.RequireTty
+	}
+	return false
+}
+
+// The seed and parameters of time-based one-time passwords, see RFC 6238.
+type Totp struct {
+	Secret    []byte         `protobuf:"bytes,1,opt,name=secret,proto3" json:"secret,omitempty"`
+	Digits    uint32         `protobuf:"varint,2,opt,name=digits" json:"digits,omitempty"`
+	Period    uint32         `protobuf:"varint,3,opt,name=period" json:"period,omitempty"`
+	Algorithm Totp_Algorithm `protobuf:"varint,4,opt,name=algorithm,enum=cmdsafe.Totp_Algorithm" json:"algorithm,omitempty"`
+}
+
+func (m *Totp) Reset()                    { *m = Totp{} }
+func (m *Totp) String() string            { return proto.CompactTextString(m) }
+func (*Totp) ProtoMessage()               {}
+func (*Totp) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+
+func (m *Totp) GetSecret() []byte {
+	if m != nil {
+		return m.Secret
+	}
+	return nil
+}
+
+func (m *Totp) GetDigits() uint32 {
+	if m != nil {
+		return m.Digits
+	}
+	return 0
+}
+
+func (m *Totp) GetPeriod() uint32 {
+	if m != nil {
+		return m.Period
+	}
+	return 0
+}
+
+func (m *Totp) GetAlgorithm() Totp_Algorithm {
+	if m != nil {
+		return m.Algorithm
+	}
+	return Totp_SHA1
+}
+
+// The hardening profile applied to a command when it is run.
+type Sandbox struct {
+	Seccomp bool `protobuf:"varint,1,opt,name=seccomp" json:"seccomp,omitempty"`
+}
+
+func (m *Sandbox) Reset()                    { *m = Sandbox{} }
+func (m *Sandbox) String() string            { return proto.CompactTextString(m) }
+func (*Sandbox) ProtoMessage()               {}
+func (*Sandbox) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+
+func (m *Sandbox) GetSeccomp() bool {
+	if m != nil {
+		return m.Seccomp
+	}
+	return false
+}
+
+// Overwriting of the arguments in the memory of a running command.
+type ArgScrub struct {
+	DelayMs int64 `protobuf:"varint,1,opt,name=delay_ms,json=delayMs" json:"delay_ms,omitempty"`
+}
+
+func (m *ArgScrub) Reset()                    { *m = ArgScrub{} }
+func (m *ArgScrub) String() string            { return proto.CompactTextString(m) }
+func (*ArgScrub) ProtoMessage()               {}
+func (*ArgScrub) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+
+func (m *ArgScrub) GetDelayMs() int64 {
+	if m != nil {
+		return m.DelayMs
+	}
+	return 0
+}
+
+// An entry of the audit log. Entries are hash-chained to detect tampering.
+type AuditRecord struct {
+	Time       int64  `protobuf:"varint,1,opt,name=time" json:"time,omitempty"`
+	Subcommand string `protobuf:"bytes,2,opt,name=subcommand" json:"subcommand,omitempty"`
+	Handle     string `protobuf:"bytes,3,opt,name=handle" json:"handle,omitempty"`
+	User       string `protobuf:"bytes,4,opt,name=user" json:"user,omitempty"`
+	Hostname   string `protobuf:"bytes,5,opt,name=hostname" json:"hostname,omitempty"`
+	Status     int32  `protobuf:"varint,6,opt,name=status" json:"status,omitempty"`
+	Duration   int64  `protobuf:"varint,7,opt,name=duration" json:"duration,omitempty"`
+	Error      string `protobuf:"bytes,8,opt,name=error" json:"error,omitempty"`
+	PrevHash   []byte `protobuf:"bytes,9,opt,name=prev_hash,json=prevHash,proto3" json:"prev_hash,omitempty"`
+	Reason     string `protobuf:"bytes,10,opt,name=reason" json:"reason,omitempty"`
+}
+
+func (m *AuditRecord) Reset()                    { *m = AuditRecord{} }
+func (m *AuditRecord) String() string            { return proto.CompactTextString(m) }
+func (*AuditRecord) ProtoMessage()               {}
+func (*AuditRecord) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+
+func (m *AuditRecord) GetTime() int64 {
+	if m != nil {
+		return m.Time
+	}
+	return 0
+}
+
+func (m *AuditRecord) GetSubcommand() string {
+	if m != nil {
+		return m.Subcommand
+	}
+	return ""
+}
+
+func (m *AuditRecord) GetHandle() string {
+	if m != nil {
+		return m.Handle
+	}
+	return ""
+}
+
+func (m *AuditRecord) GetUser() string {
+	if m != nil {
+		return m.User
+	}
+	return ""
+}
+
+func (m *AuditRecord) GetHostname() string {
+	if m != nil {
+		return m.Hostname
+	}
+	return ""
+}
+
+func (m *AuditRecord) GetStatus() int32 {
+	if m != nil {
+		return m.Status
+	}
+	return 0
+}
+
+func (m *AuditRecord) GetDuration() int64 {
+	if m != nil {
+		return m.Duration
+	}
+	return 0
+}
+
+func (m *AuditRecord) GetError() string {
+	if m != nil {
+		return m.Error
+	}
+	return ""
+}
+
+func (m *AuditRecord) GetPrevHash() []byte {
+	if m != nil {
+		return m.PrevHash
+	}
+	return nil
+}
+
+func (m *AuditRecord) GetReason() string {
+	if m != nil {
+		return m.Reason
+	}
+	return ""
+}
+
+// An X25519 key pair identifying a user as the recipient of shared commands.
+type Identity struct {
+	Name       string `protobuf:"bytes,1,opt,name=name" json:"name,omitempty"`
+	PublicKey  []byte `protobuf:"bytes,2,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"`
+	PrivateKey []byte `protobuf:"bytes,3,opt,name=private_key,json=privateKey,proto3" json:"private_key,omitempty"`
+	Created    int64  `protobuf:"varint,4,opt,name=created" json:"created,omitempty"`
+}
+
+func (m *Identity) Reset()                    { *m = Identity{} }
+func (m *Identity) String() string            { return proto.CompactTextString(m) }
+func (*Identity) ProtoMessage()               {}
+func (*Identity) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{6} }
+
+func (m *Identity) GetName() string {
+	if m != nil {
+		return m.Name
+	}
+	return ""
+}
+
+func (m *Identity) GetPublicKey() []byte {
+	if m != nil {
+		return m.PublicKey
+	}
+	return nil
+}
+
+func (m *Identity) GetPrivateKey() []byte {
+	if m != nil {
+		return m.PrivateKey
+	}
+	return nil
+}
+
+func (m *Identity) GetCreated() int64 {
+	if m != nil {
+		return m.Created
+	}
+	return 0
+}
+
+// A previous revision of a command entry, kept in the history bucket when the
+// entry is replaced and in the trash bucket when it is deleted.
+type Revision struct {
+	Envelope []byte `protobuf:"bytes,1,opt,name=envelope,proto3" json:"envelope,omitempty"`
+	Time     int64  `protobuf:"varint,2,opt,name=time" json:"time,omitempty"`
+	Deleted  bool   `protobuf:"varint,3,opt,name=deleted" json:"deleted,omitempty"`
+}
+
+func (m *Revision) Reset()                    { *m = Revision{} }
+func (m *Revision) String() string            { return proto.CompactTextString(m) }
+func (*Revision) ProtoMessage()               {}
+func (*Revision) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{7} }
+
+func (m *Revision) GetEnvelope() []byte {
+	if m != nil {
+		return m.Envelope
+	}
+	return nil
+}
+
+func (m *Revision) GetTime() int64 {
+	if m != nil {
+		return m.Time
+	}
+	return 0
+}
+
+func (m *Revision) GetDeleted() bool {
+	if m != nil {
+		return m.Deleted
+	}
+	return false
+}
+
+func init() {
+	proto.RegisterType((*Command)(nil), "cmdsafe.Command")
+	proto.RegisterType((*Policy)(nil), "cmdsafe.Policy")
+	proto.RegisterType((*Totp)(nil), "cmdsafe.Totp")
+	proto.RegisterType((*Sandbox)(nil), "cmdsafe.Sandbox")
+	proto.RegisterType((*ArgScrub)(nil), "cmdsafe.ArgScrub")
+	proto.RegisterType((*AuditRecord)(nil), "cmdsafe.AuditRecord")
+	proto.RegisterType((*Identity)(nil), "cmdsafe.Identity")
+	proto.RegisterType((*Revision)(nil), "cmdsafe.Revision")
+	proto.RegisterEnum("cmdsafe.Totp_Algorithm", Totp_Algorithm_name, Totp_Algorithm_value)
+}
+
+func init() { proto.RegisterFile("cmdsafe.proto", fileDescriptor0) }
+
+var fileDescriptor0 = []byte{
+	// 783 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x94, 0x54, 0xdd, 0x8e, 0xe3, 0x34,
+	0x14, 0x26, 0x4d, 0xdb, 0x24, 0xa7, 0xd3, 0xdd, 0x62, 0x21, 0xc8, 0x0e, 0x2c, 0x94, 0xa0, 0xd5,
+	0x56, 0x20, 0x2a, 0x6d, 0x61, 0x56, 0xc0, 0x5d, 0x59, 0x8d, 0x34, 0x08, 0x21, 0x21, 0xcf, 0x5c,
+	0x71, 0x13, 0xb9, 0xc9, 0xd9, 0x36, 0xda, 0x24, 0x0e, 0xb6, 0x13, 0xa6, 0x6f, 0xc0, 0x33, 0xf0,
+	0x06, 0xdc, 0xf3, 0x80, 0xc8, 0x27, 0x4e, 0x76, 0x10, 0xdc, 0x70, 0x77, 0xbe, 0xef, 0x7c, 0xc7,
+	0xf6, 0xf9, 0x33, 0x2c, 0xb3, 0x2a, 0xd7, 0xe2, 0x35, 0x6e, 0x1b, 0x25, 0x8d, 0x64, 0x81, 0x83,
+	0xc9, 0x9f, 0x53, 0x08, 0x5e, 0xc9, 0xaa, 0x12, 0x75, 0xce, 0x18, 0x4c, 0x6b, 0x51, 0x61, 0xec,
+	0xad, 0xbd, 0x4d, 0xc4, 0xc9, 0x66, 0x1f, 0x03, 0xe0, 0x3d, 0x66, 0xad, 0x11, 0x87, 0x12, 0xe3,
+	0x09, 0x79, 0x1e, 0x30, 0x36, 0x46, 0xa8, 0xa3, 0x8e, 0xfd, 0xb5, 0x6f, 0x63, 0xac, 0xcd, 0x3e,
+	0x87, 0x40, 0x8b, 0x3a, 0x3f, 0xc8, 0xfb, 0x78, 0xba, 0xf6, 0x36, 0x8b, 0xdd, 0x6a, 0x3b, 0xdc,
+	0x7e, 0xdb, 0xf3, 0x7c, 0x10, 0xb0, 0x2d, 0x44, 0x42, 0x1d, 0x53, 0x9d, 0xa9, 0xf6, 0x10, 0xcf,
+	0x48, 0xfd, 0xee, 0xa8, 0xde, 0xab, 0xe3, 0xad, 0x75, 0xf0, 0x50, 0x38, 0x8b, 0x7d, 0x01, 0x3e,
+	0xd6, 0x5d, 0x3c, 0x5f, 0xfb, 0x9b, 0xc5, 0xee, 0xc9, 0xa8, 0x74, 0x29, 0x6c, 0xaf, 0xeb, 0xee,
+	0xba, 0x36, 0xea, 0xcc, 0xad, 0x8a, 0x7d, 0x0d, 0x73, 0x23, 0xdf, 0x60, 0xad, 0xe3, 0x80, 0xf4,
+	0x1f, 0xfd, 0x4b, 0x7f, 0x47, 0xee, 0x3e, 0xc4, 0x69, 0xd9, 0xa7, 0x30, 0x35, 0xd2, 0x34, 0x71,
+	0x48, 0xaf, 0x59, 0x8e, 0x31, 0x77, 0xd2, 0x34, 0x9c, 0x5c, 0x2c, 0x86, 0x00, 0xef, 0x9b, 0x42,
+	0xa1, 0x8e, 0xa3, 0xb5, 0xb7, 0xf1, 0xf9, 0x00, 0xd9, 0x73, 0x98, 0x37, 0xb2, 0x2c, 0xb2, 0x73,
+	0x0c, 0x14, 0xfe, 0x78, 0x0c, 0xff, 0x99, 0x68, 0xee, 0xdc, 0xec, 0x13, 0x58, 0x68, 0xcc, 0x14,
+	0x9a, 0x94, 0xea, 0xb7, 0x58, 0xfb, 0x9b, 0x25, 0x87, 0x9e, 0xda, 0xdb, 0x2a, 0x3e, 0x05, 0x87,
+	0x52, 0x9b, 0xf0, 0x05, 0xd5, 0x37, 0xea, 0x99, 0xeb, 0xba, 0xbb, 0x7c, 0x09, 0xe1, 0x90, 0x2c,
+	0x5b, 0x81, 0xff, 0x06, 0xcf, 0xae, 0x6f, 0xd6, 0x64, 0xef, 0xc1, 0xac, 0x13, 0x65, 0x3b, 0x74,
+	0xac, 0x07, 0xdf, 0x4d, 0xbe, 0xf1, 0x2e, 0xbf, 0x85, 0xc5, 0x83, 0xa4, 0xff, 0x4f, 0x68, 0xf2,
+	0x87, 0x07, 0xf3, 0x3e, 0x0b, 0xf6, 0x1c, 0x1e, 0x2b, 0xfc, 0xb5, 0x2d, 0x14, 0xa6, 0x99, 0xac,
+	0x5f, 0x17, 0xaa, 0xa2, 0x23, 0x42, 0xfe, 0xc8, 0xd1, 0xaf, 0x7a, 0xd6, 0xa6, 0x29, 0xca, 0x52,
+	0xfe, 0x96, 0x9e, 0x64, 0xab, 0xf4, 0x30, 0x40, 0x44, 0xdd, 0x58, 0x86, 0x3d, 0x83, 0x21, 0x24,
+	0x55, 0x28, 0xb4, 0xac, 0x63, 0x9f, 0x0e, 0x5a, 0x3a, 0x96, 0x13, 0x69, 0xcf, 0x19, 0x64, 0xc6,
+	0x9c, 0x69, 0xae, 0x42, 0x0e, 0x8e, 0xba, 0x33, 0xe7, 0xe4, 0x2f, 0x0f, 0xa6, 0xb6, 0x43, 0xec,
+	0x7d, 0x98, 0xf7, 0x55, 0xa2, 0x17, 0x5d, 0x70, 0x87, 0x2c, 0x9f, 0x17, 0xc7, 0xc2, 0xf4, 0x8f,
+	0x58, 0x72, 0x87, 0x2c, 0xdf, 0xa0, 0x2a, 0x64, 0x4e, 0x17, 0x2f, 0xb9, 0x43, 0xec, 0x0a, 0x22,
+	0x51, 0x1e, 0xa5, 0x2a, 0xcc, 0xa9, 0xa2, 0xfb, 0x1e, 0xed, 0x3e, 0xf8, 0xc7, 0x2c, 0x6c, 0xf7,
+	0x83, 0x9b, 0xbf, 0x55, 0x26, 0x5f, 0x42, 0x34, 0xf2, 0x2c, 0x84, 0xe9, 0xed, 0xcd, 0xfe, 0xc5,
+	0xea, 0x1d, 0x06, 0x30, 0xbf, 0xbd, 0xd9, 0xef, 0xae, 0x5e, 0xae, 0x3c, 0x67, 0x5f, 0xbd, 0xd8,
+	0xad, 0x26, 0xc9, 0x67, 0x10, 0xb8, 0x9d, 0xb0, 0x43, 0xa5, 0x31, 0xcb, 0x64, 0xd5, 0xb8, 0x5a,
+	0x0e, 0x30, 0x79, 0x06, 0xe1, 0xb0, 0x0a, 0xec, 0x09, 0x84, 0x39, 0x96, 0xe2, 0x9c, 0x56, 0x9a,
+	0x64, 0x3e, 0x0f, 0x08, 0xff, 0xa4, 0x93, 0xdf, 0x27, 0xb0, 0xd8, 0xb7, 0x79, 0x61, 0x38, 0x66,
+	0x52, 0xd1, 0x3e, 0x9b, 0xc2, 0xed, 0xb3, 0xcf, 0xc9, 0xb6, 0xfb, 0xac, 0xdb, 0x43, 0xd6, 0x8f,
+	0xff, 0xd0, 0x8e, 0xb7, 0x8c, 0xad, 0xc6, 0x49, 0xd4, 0x79, 0x89, 0x54, 0x8d, 0x88, 0x3b, 0x64,
+	0xcf, 0x6a, 0x35, 0x2a, 0x2a, 0x44, 0xc4, 0xc9, 0x66, 0x97, 0x10, 0x9e, 0xa4, 0x36, 0xf4, 0x67,
+	0xcc, 0x88, 0x1f, 0x31, 0x75, 0xc1, 0x08, 0xd3, 0xea, 0x78, 0xbe, 0xf6, 0x36, 0x33, 0xee, 0x90,
+	0x8d, 0xc9, 0x5b, 0x25, 0x4c, 0x21, 0xeb, 0x38, 0xa0, 0x77, 0x8d, 0xd8, 0x4e, 0x1e, 0x2a, 0x25,
+	0x15, 0x6d, 0x5e, 0xc4, 0x7b, 0xc0, 0x3e, 0x84, 0xa8, 0x51, 0xd8, 0xa5, 0x27, 0xa1, 0x4f, 0xb4,
+	0x6d, 0x17, 0x3c, 0xb4, 0xc4, 0x8d, 0xd0, 0x27, 0x7b, 0x8d, 0x9b, 0x1a, 0xe8, 0x9f, 0xdb, 0xa3,
+	0xe4, 0x1e, 0xc2, 0x1f, 0x72, 0xac, 0x4d, 0x61, 0xce, 0xff, 0xf9, 0xad, 0x3d, 0x05, 0x68, 0xda,
+	0x43, 0x59, 0x64, 0xa9, 0x9d, 0xfe, 0x09, 0x9d, 0x1a, 0xf5, 0xcc, 0x8f, 0x48, 0xcb, 0xd9, 0xa8,
+	0xa2, 0x13, 0x06, 0xc9, 0xef, 0x93, 0x1f, 0x1c, 0x65, 0x05, 0x31, 0x04, 0x99, 0x42, 0x61, 0x30,
+	0xa7, 0x8a, 0xf8, 0x7c, 0x80, 0xc9, 0x1d, 0x84, 0x1c, 0xbb, 0x42, 0xdb, 0x84, 0x2e, 0x21, 0xc4,
+	0xba, 0xc3, 0x52, 0x36, 0xe8, 0x86, 0x71, 0xc4, 0x63, 0x73, 0x26, 0x0f, 0x9a, 0x13, 0x83, 0xed,
+	0x25, 0xda, 0x53, 0xfb, 0x25, 0x18, 0xe0, 0xf7, 0xc1, 0x2f, 0xb3, 0x4e, 0xb4, 0xa5, 0x39, 0xcc,
+	0xe9, 0xff, 0xfe, 0xea, 0xef, 0x01, 0x00, 0xaa, 0xb4, 0xf6, 0x65, 0xd0, 0x05, 0x00, 0x00,
+}
@@ -0,0 +1,197 @@
+// This file implements storing and retrieving commands.
+
+package vault
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aleist/cmdsafe/crypto"
+	"github.com/golang/protobuf/proto"
+)
+
+// Save stores cmdData under its name, encrypted for a password from the
+// password provider. Returns an *ExistsError if a command of that name is
+// stored already, unless replace is set.
+//
+// The command must have a name and an executable. Its secret references must
+// use known schemes, the {{totp}} placeholder requires a TOTP seed and the
+// allowed hours of its policy must be well-formed.
+func (v *Vault) Save(cmdData *Command, replace bool) error {
+	handle := cmdData.Name
+	if handle == "" {
+		return fmt.Errorf("the command has no name")
+	}
+	if cmdData.Executable == "" {
+		return fmt.Errorf("%s has no executable", handle)
+	}
+	if err := checkSecretRefs(cmdData); err != nil {
+		return err
+	}
+	if err := checkSecretMarks(cmdData); err != nil {
+		return err
+	}
+	for scheme := range cmdData.Tokens {
+		if !HasResolver(scheme) {
+			return fmt.Errorf("unknown secret reference scheme %q", scheme)
+		}
+	}
+	if cmdData.UsesTOTP() && cmdData.Totp == nil {
+		return fmt.Errorf("%s requires a TOTP seed", TOTPPlaceholder)
+	}
+	if err := cmdData.Policy.Validate(); err != nil {
+		return err
+	}
+
+	pwd, err := v.password(handle, NewPassword)
+	if err != nil {
+		return err
+	}
+
+	// Encrypt the command data and wrap the data key with the password.
+	cryptoEnv, dataKey, err := sealCommand(cmdData, crypto.EncryptAESCTR, sha256.New)
+	if err != nil {
+		return err
+	}
+	recipient, err := v.newPasswordRecipient(dataKey, pwd)
+	if err != nil {
+		return err
+	}
+	cryptoEnv.Recipients = []*crypto.Recipient{recipient}
+
+	// Serialise the crypto envelope.
+	cryptoEnvMsg, err := proto.Marshal(cryptoEnv)
+	if err != nil {
+		return fmt.Errorf("failed to serialise the crypto envelope: %v", err)
+	}
+
+	return v.update(v.writeCommand([]byte(handle), cryptoEnvMsg, replace))
+}
+
+// Get returns the command stored under handle, decrypted with a password from
+// the password provider. Returns a *NotFoundError if there is no such command
+// and ErrIncorrectPassword if the password does not match.
+func (v *Vault) Get(handle string) (*Command, error) {
+	// Load and parse the crypto envelope first, so that no password is asked
+	// for a missing command.
+	cryptoEnvMsg, err := v.loadCommandData([]byte(handle))
+	if err != nil {
+		return nil, err
+	}
+	cryptoEnv, err := unmarshalEnvelope(handle, cryptoEnvMsg)
+	if err != nil {
+		return nil, err
+	}
+
+	pwd, err := v.password(handle, UnlockPassword)
+	if err != nil {
+		return nil, err
+	}
+	return v.decryptCommandData(handle, cryptoEnv, pwd)
+}
+
+// List returns the handles of all stored commands in ascending order.
+func (v *Vault) List() ([]string, error) {
+	var handles []string
+	err := v.view(func(tx Tx) error {
+		keys, err := tx.List(commandBucketName, nil)
+		for _, k := range keys {
+			handles = append(handles, string(k))
+		}
+		return err
+	})
+
+	return handles, err
+}
+
+// writeCommand returns a closure that saves the command data value under key
+// handle in the store. A replaced entry is kept in the history.
+func (v *Vault) writeCommand(handle, value []byte, replace bool) func(tx Tx) error {
+	return func(tx Tx) error {
+		// Check if entry already exists; only replace if explicitly requested.
+		old, err := tx.Get(commandBucketName, handle)
+		if err != nil {
+			return err
+		}
+		if old != nil && !replace {
+			return &ExistsError{Handle: string(handle)}
+		}
+		if old != nil {
+			revision := &Revision{Envelope: old, Time: time.Now().UnixNano()}
+			if err := v.archiveRevision(tx, string(handle), revision); err != nil {
+				return err
+			}
+		}
+
+		return tx.Put(commandBucketName, handle, value)
+	}
+}
+
+// unmarshalEnvelope deserialises the crypto envelope stored under handle and
+// checks that it is structurally valid and that we support its algorithms.
+// Failed checks are returned as *IntegrityError.
+func unmarshalEnvelope(handle string, msg []byte) (*crypto.CryptoEnvelope, error) {
+	cryptoEnv := &crypto.CryptoEnvelope{}
+	if err := proto.Unmarshal(msg, cryptoEnv); err != nil {
+		return nil, &IntegrityError{Handle: handle,
+			Err: fmt.Errorf("failed to deserialise the crypto envelope: %v", err)}
+	}
+	if err := cryptoEnv.Validate(); err != nil {
+		return nil, &IntegrityError{Handle: handle, Err: err}
+	}
+	return cryptoEnv, nil
+}
+
+// loadCommandData loads the unprocessed command data from key handle in the
+// store.
+func (v *Vault) loadCommandData(handle []byte) ([]byte, error) {
+	var value []byte
+	err := v.view(func(tx Tx) error {
+		var err error
+		value, err = tx.Get(commandBucketName, handle)
+		if err == nil && value == nil {
+			err = &NotFoundError{Handle: string(handle)}
+		}
+		return err
+	})
+
+	return value, err
+}
+
+// MapValues replaces each argument and environment value of c with the result
+// of fn, stopping at the first error.
+func (c *Command) MapValues(fn func(value string) (string, error)) error {
+	for i, arg := range c.Args {
+		value, err := fn(arg)
+		if err != nil {
+			return err
+		}
+		c.Args[i] = value
+	}
+	for name, env := range c.Env {
+		value, err := fn(env)
+		if err != nil {
+			return err
+		}
+		c.Env[name] = value
+	}
+	return nil
+}
+
+// Environ returns the environment variables of c in the form "name=value",
+// sorted by name.
+func (c *Command) Environ() []string {
+	names := make([]string, 0, len(c.Env))
+	for name := range c.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	env := make([]string, len(names))
+	for i, name := range names {
+		env[i] = name + "=" + c.Env[name]
+	}
+	return env
+}
@@ -0,0 +1,73 @@
+// This file implements compacting the database file.
+
+package vault
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Compact rewrites the database into a fresh file, which replaces the current
+// one. Bolt reuses freed pages without zeroing them, so the current file may
+// still hold deleted and replaced entries. If secure is set, the current file
+// is overwritten with zeros once it has been replaced.
+//
+// Only bolt stores support compacting. As an agent keeps the database open,
+// it must be stopped first.
+func (v *Vault) Compact(secure bool) error {
+	if !v.opts.NoAgent && agentRunning(v.path) {
+		return fmt.Errorf("cannot compact %s while an agent is serving it", v.path)
+	}
+	return v.accessStore(false, func(store Store) error {
+		c, ok := store.(interface{ Compact(secure bool) error })
+		if !ok {
+			return fmt.Errorf("the %s backend does not support compacting", v.backend)
+		}
+		return c.Compact(secure)
+	})
+}
+
+// replaceFile replaces the file at path with the file at newPath by renaming
+// it and syncs the directory. If secure is set, the replaced file is
+// overwritten with zeros, which only reaches the disk on file systems that
+// update files in place.
+func replaceFile(path, newPath string, secure bool) error {
+	// Keep the replaced file open to overwrite it after the rename.
+	old, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer old.Close()
+
+	if err := os.Rename(newPath, path); err != nil {
+		_ = os.Remove(newPath)
+		return err
+	}
+	if secure {
+		if err := overwriteFile(old); err != nil {
+			return fmt.Errorf("failed to overwrite the replaced database: %v", err)
+		}
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// overwriteFile overwrites the whole content of f with zeros and flushes it to
+// disk.
+func overwriteFile(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	zeros := make([]byte, 64*1024)
+	for off := int64(0); off < info.Size(); off += int64(len(zeros)) {
+		n := int64(len(zeros))
+		if info.Size()-off < n {
+			n = info.Size() - off
+		}
+		if _, err := f.WriteAt(zeros[:n], off); err != nil {
+			return err
+		}
+	}
+	return f.Sync()
+}
@@ -0,0 +1,167 @@
+// This file implements the encryption of command data.
+
+package vault
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+
+	"github.com/aleist/cmdsafe/crypto"
+	"github.com/golang/protobuf/proto"
+)
+
+// sealCommand serialises cmdData and then encrypts it with crypto.Seal.
+// See the latter for details on the parameters. The expiry date and run
+// policy of cmdData are copied into the envelope unencrypted.
+func sealCommand(cmdData *Command, fn crypto.EncryptFn,
+		hashFn func() hash.Hash) (*crypto.CryptoEnvelope, []byte, error) {
+
+	plaintext, err := proto.Marshal(cmdData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal the command data: %v", err)
+	}
+
+	env, dataKey, err := crypto.Seal(plaintext, fn, hashFn)
+	if err != nil {
+		return nil, nil, err
+	}
+	// Keep copies of the expiry date and run policy readable without a
+	// password.
+	env.Expires = cmdData.Expires
+	if cmdData.Policy != nil {
+		if env.Policy, err = proto.Marshal(cmdData.Policy); err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal the run policy: %v", err)
+		}
+	}
+	return env, dataKey, nil
+}
+
+// openCommand decrypts the Command in env.Data with crypto.Open.
+// See the latter for details on the parameters.
+func openCommand(env *crypto.CryptoEnvelope, dataKey []byte, fn crypto.DecryptFn,
+		hashFn func() hash.Hash) (*Command, error) {
+
+	plaintext, err := crypto.Open(env, dataKey, fn, hashFn)
+	if err != nil {
+		return nil, err
+	}
+
+	cmdData := &Command{}
+	if err := proto.Unmarshal(plaintext, cmdData); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the command data: %v", err)
+	}
+
+	return cmdData, nil
+}
+
+// newPasswordRecipient derives a new user key from password with a random salt
+// and the configured scrypt parameters and wraps dataKey with it.
+func (v *Vault) newPasswordRecipient(dataKey, password []byte) (*crypto.Recipient, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate the random password salt: %v", err)
+	}
+	scryptConfig := v.opts.KDF.scryptConfig(salt)
+	key, err := crypto.NewScryptKey(password, scryptConfig.Salt,
+		int(scryptConfig.N), int(scryptConfig.R), int(scryptConfig.P))
+	if err != nil {
+		return nil, err
+	}
+
+	return crypto.NewPasswordRecipient(dataKey, key, scryptConfig, crypto.EncryptAESCTR, sha256.New)
+}
+
+// deriveUserKey derives the key described by userKey from password. Returns
+// ErrIncorrectPassword if its hash does not match the stored hash.
+func deriveUserKey(userKey *crypto.UserKey, password []byte) (crypto.Key, error) {
+	scryptConfig := userKey.Scrypt
+	key, err := crypto.NewScryptKey(password, scryptConfig.Salt,
+		int(scryptConfig.N), int(scryptConfig.R), int(scryptConfig.P))
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Compare(key.Hash(), userKey.Hash) != 0 {
+		return nil, ErrIncorrectPassword
+	}
+	return key, nil
+}
+
+// unlockEnvelope returns the data key of cryptoEnv, unwrapped with password.
+// Returns ErrIncorrectPassword if password matches none of its recipients.
+// Public key recipients are unwrapped with a stored identity whose private key
+// password decrypts, see unlockWithIdentity.
+//
+// A legacy envelope with a single user key is converted to the recipients form
+// in place, leaving the encrypted data unchanged.
+func (v *Vault) unlockEnvelope(cryptoEnv *crypto.CryptoEnvelope, password []byte) ([]byte, error) {
+	if len(cryptoEnv.Recipients) == 0 {
+		key, err := deriveUserKey(cryptoEnv.UserKey, password)
+		if err != nil {
+			return nil, err
+		}
+		dataKey, err := crypto.UnwrapLegacy(cryptoEnv, key, crypto.DecryptAESCTR, sha256.New)
+		if err != nil {
+			return nil, err
+		}
+
+		recipient, err := crypto.NewPasswordRecipient(dataKey, key, cryptoEnv.UserKey.Scrypt,
+			crypto.EncryptAESCTR, sha256.New)
+		if err != nil {
+			return nil, err
+		}
+		cryptoEnv.Recipients = []*crypto.Recipient{recipient}
+		cryptoEnv.UserKey = nil
+		cryptoEnv.Key = nil
+		return dataKey, crypto.SignEnvelope(cryptoEnv, dataKey, sha256.New)
+	}
+
+	for _, r := range cryptoEnv.Recipients {
+		if r.Type != crypto.RecipientType_PASSWORD {
+			continue
+		}
+		key, err := deriveUserKey(r.UserKey, password)
+		if err == ErrIncorrectPassword {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		return r.Unwrap(key, crypto.DecryptAESCTR, sha256.New)
+	}
+	return v.unlockWithIdentity(cryptoEnv, password)
+}
+
+// decryptCommandData decrypts the command data stored under handle in
+// cryptoEnv with password. Returns ErrIncorrectPassword if the password does
+// not match any the data was encrypted for.
+func (v *Vault) decryptCommandData(handle string, cryptoEnv *crypto.CryptoEnvelope,
+		password []byte) (*Command, error) {
+
+	dataKey, err := v.unlockEnvelope(cryptoEnv, password)
+	if err != nil {
+		return nil, err
+	}
+	return openCommandData(handle, cryptoEnv, dataKey)
+}
+
+// openCommandData decrypts the command data stored under handle in cryptoEnv
+// with its data key. Failed checks are returned as *IntegrityError.
+func openCommandData(handle string, cryptoEnv *crypto.CryptoEnvelope,
+		dataKey []byte) (*Command, error) {
+
+	cmdData, err := openCommand(cryptoEnv, dataKey, crypto.DecryptAESCTR, sha256.New)
+	if err != nil {
+		return nil, &IntegrityError{Handle: handle, Err: err}
+	}
+
+	// Verify that the stored command name matches the handle to ensure the DB
+	// has not been tampered with and the command belongs to a different handle.
+	if cmdData.Name != handle {
+		return nil, &IntegrityError{Handle: handle,
+			Err: fmt.Errorf("command name mismatch, the database may have been tempered with")}
+	}
+
+	return cmdData, nil
+}
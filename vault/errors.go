@@ -0,0 +1,97 @@
+// This file implements the errors returned by the vault.
+
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrIncorrectPassword is returned if a password does not match any the
+// command data or identity was encrypted for.
+var ErrIncorrectPassword = errors.New("incorrect password")
+
+// NotFoundError is returned if there is no command stored under Handle.
+type NotFoundError struct {
+	Handle string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("%s not found", e.Handle)
+}
+
+// ExistsError is returned by Save if a command is stored under Handle already
+// and replacing it was not requested.
+type ExistsError struct {
+	Handle string
+}
+
+func (e *ExistsError) Error() string {
+	return fmt.Sprintf("%s exists already", e.Handle)
+}
+
+// IntegrityError is returned if the entry stored under Handle is malformed or
+// fails verification, which means it is corrupt or has been tampered with.
+type IntegrityError struct {
+	Handle string
+	Err    error // The failed check.
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Handle, e.Err)
+}
+
+// Unwrap returns the failed check.
+func (e *IntegrityError) Unwrap() error {
+	return e.Err
+}
+
+// PolicyError is returned by Run if the policy of the command stored under
+// Handle denies running it, see Command.Policy.
+type PolicyError struct {
+	Handle string
+	Reason string // Why the run was denied.
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("running %s denied by its policy: %s", e.Handle, e.Reason)
+}
+
+// ConflictError is returned for an entry of a git store that has been edited
+// on both sides of a merge. It has to be resolved in the repository.
+type ConflictError struct {
+	Handle string
+	Reason string // How the conflict shows.
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("conflicting edits to %s: %s", e.Handle, e.Reason)
+}
+
+// LockedError is returned if the database stays locked by another process for
+// longer than the timeout, see Options.
+type LockedError struct {
+	Path    string
+	Timeout time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("the database %s is locked by another process, gave up after %v", e.Path, e.Timeout)
+}
+
+// FormatError is returned if the database has been written by a newer version
+// with an unsupported format, or by an older version and not upgraded yet, see
+// Vault.Upgrade.
+type FormatError struct {
+	Version uint64 // The format version of the database.
+}
+
+func (e *FormatError) Error() string {
+	if e.Version < dbFormatVersion {
+		return fmt.Sprintf("database format version %d is older than the current version %d, "+
+			"run `cmdsafe migrate` to upgrade it", e.Version, dbFormatVersion)
+	}
+	return fmt.Sprintf("database format version %d is newer than the supported version %d, "+
+		"please upgrade cmdsafe", e.Version, dbFormatVersion)
+}
@@ -0,0 +1,47 @@
+// This file implements the expiry dates of commands.
+
+package vault
+
+import (
+	"time"
+)
+
+// Expiries returns the expiry dates of all commands that have one, see
+// Command.Expires, by handle. No password is needed, as a copy of each date is
+// stored unencrypted. Unlike the date Run checks, the copy is not protected
+// against tampering.
+func (v *Vault) Expiries() (map[string]time.Time, error) {
+	expiries := map[string]time.Time{}
+	err := v.view(func(tx Tx) error {
+		keys, err := tx.List(commandBucketName, nil)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			value, err := tx.Get(commandBucketName, k)
+			if err != nil {
+				return err
+			}
+			cryptoEnv, err := unmarshalEnvelope(string(k), value)
+			if err != nil {
+				return err
+			}
+			if cryptoEnv.Expires != 0 {
+				expiries[string(k)] = time.Unix(0, cryptoEnv.Expires)
+			}
+		}
+		return nil
+	})
+	return expiries, err
+}
+
+// checkExpiry calls opts.OnExpired if cmdData is past its expiry date.
+func checkExpiry(cmdData *Command, opts *RunOptions) error {
+	if cmdData.Expires == 0 || opts.OnExpired == nil {
+		return nil
+	}
+	if expires := time.Unix(0, cmdData.Expires); !time.Now().Before(expires) {
+		return opts.OnExpired(expires)
+	}
+	return nil
+}
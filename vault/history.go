@@ -0,0 +1,134 @@
+// This file implements the history of replaced and deleted commands.
+
+package vault
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// defaultHistoryLimit is the number of revisions kept per command by default.
+const defaultHistoryLimit = 10
+
+// historyPrefix returns the prefix of the keys in the history bucket holding
+// the revisions of handle, which are followed by the revision number.
+func historyPrefix(handle string) []byte {
+	return append([]byte(handle), 0)
+}
+
+// historyKey returns the key in the history bucket of revision rev of handle.
+func historyKey(handle string, rev uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, rev)
+	return append(historyPrefix(handle), key...)
+}
+
+// History calls fn with each revision kept of the command stored under handle
+// and its revision number, from the oldest to the latest. A revision is kept
+// whenever a command is replaced, and a deleted command when it is replaced in
+// the trash by a later deletion, up to Options.HistoryLimit.
+func (v *Vault) History(handle string, fn func(rev uint64, revision *Revision)) error {
+	return v.view(func(tx Tx) error {
+		prefix := historyPrefix(handle)
+		keys, err := tx.List(historyBucketName, prefix)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			rev := binary.BigEndian.Uint64(k[len(prefix):])
+			revision, err := loadRevision(tx, handle, rev)
+			if err != nil {
+				return err
+			}
+			fn(rev, revision)
+		}
+		return nil
+	})
+}
+
+// Restore makes revision rev of handle the current command, after asking the
+// password provider for a password to verify that the revision decrypts and
+// belongs to handle. The command it replaces, if any, is kept in the history.
+func (v *Vault) Restore(handle string, rev uint64) error {
+	var revision *Revision
+	err := v.view(func(tx Tx) error {
+		var err error
+		revision, err = loadRevision(tx, handle, rev)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	cryptoEnv, err := unmarshalEnvelope(handle, revision.Envelope)
+	if err != nil {
+		return err
+	}
+	pwd, err := v.password(handle, UnlockPassword)
+	if err != nil {
+		return err
+	}
+	// Decrypting checks the name, so an entry cannot be restored under a
+	// different handle.
+	if _, err := v.decryptCommandData(handle, cryptoEnv, pwd); err != nil {
+		return err
+	}
+
+	return v.update(v.writeCommand([]byte(handle), revision.Envelope, true))
+}
+
+// loadRevision loads revision rev of handle from the history bucket.
+func loadRevision(tx Tx, handle string, rev uint64) (*Revision, error) {
+	value, err := tx.Get(historyBucketName, historyKey(handle, rev))
+	if err != nil {
+		return nil, err
+	}
+	if value == nil {
+		return nil, fmt.Errorf("%s has no revision %d", handle, rev)
+	}
+	revision := &Revision{}
+	if err := proto.Unmarshal(value, revision); err != nil {
+		return nil, fmt.Errorf("%s: failed to deserialise revision %d: %v", handle, rev, err)
+	}
+	return revision, nil
+}
+
+// archiveRevision adds revision, an entry of handle being replaced, to the
+// history as its latest revision. The oldest revisions beyond the history
+// limit are removed.
+func (v *Vault) archiveRevision(tx Tx, handle string, revision *Revision) error {
+	limit := v.opts.HistoryLimit
+	if limit < 0 {
+		return nil
+	} else if limit == 0 {
+		limit = defaultHistoryLimit
+	}
+
+	prefix := historyPrefix(handle)
+	keys, err := tx.List(historyBucketName, prefix)
+	if err != nil {
+		return err
+	}
+	var rev uint64 = 1
+	if len(keys) > 0 {
+		rev = binary.BigEndian.Uint64(keys[len(keys)-1][len(prefix):]) + 1
+	}
+
+	value, err := proto.Marshal(revision)
+	if err != nil {
+		return fmt.Errorf("failed to serialise the revision: %v", err)
+	}
+	key := historyKey(handle, rev)
+	if err := tx.Put(historyBucketName, key, value); err != nil {
+		return err
+	}
+
+	for keys = append(keys, key); len(keys) > limit; keys = keys[1:] {
+		if err := tx.Delete(historyBucketName, keys[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+// This file implements identities, the X25519 key pairs commands can be shared
+// with.
+
+package vault
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aleist/cmdsafe/crypto"
+	"github.com/golang/protobuf/proto"
+)
+
+// identityKeyPrefix is the prefix of the keys in the config bucket holding
+// identities, followed by the identity name.
+const identityKeyPrefix = "identity/"
+
+// NewIdentity generates an X25519 key pair and stores it under name, with the
+// private key encrypted with a key derived from a new password from the
+// password provider.
+func (v *Vault) NewIdentity(name string) (*Identity, error) {
+	pwd, err := v.password("", NewPassword)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, publicKey, err := crypto.GenerateX25519Key()
+	if err != nil {
+		return nil, err
+	}
+	privateKeyEnv, err := v.encryptPrivateKey(privateKey, pwd)
+	if err != nil {
+		return nil, err
+	}
+	privateKeyMsg, err := proto.Marshal(privateKeyEnv)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialise the crypto envelope: %v", err)
+	}
+
+	identity := &Identity{
+		Name:       name,
+		PublicKey:  publicKey,
+		PrivateKey: privateKeyMsg,
+		Created:    time.Now().Unix(),
+	}
+	identityMsg, err := proto.Marshal(identity)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialise the identity: %v", err)
+	}
+
+	err = v.update(func(tx Tx) error {
+		key := []byte(identityKeyPrefix + name)
+		if old, err := tx.Get(configBucketName, key); err != nil {
+			return err
+		} else if old != nil {
+			return fmt.Errorf("identity %s already exists", name)
+		}
+		return tx.Put(configBucketName, key, identityMsg)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+// encryptPrivateKey encrypts privateKey with a key derived from password with
+// a random salt and the configured scrypt parameters.
+func (v *Vault) encryptPrivateKey(privateKey, password []byte) (*crypto.CryptoEnvelope, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate the random password salt: %v", err)
+	}
+	scryptConfig := v.opts.KDF.scryptConfig(salt)
+	key, err := crypto.NewScryptKey(password, scryptConfig.Salt,
+		int(scryptConfig.N), int(scryptConfig.R), int(scryptConfig.P))
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := crypto.Encrypt(privateKey, key, crypto.EncryptAESCTR, sha256.New)
+	if err != nil {
+		return nil, err
+	}
+	env.UserKey = &crypto.UserKey{
+		Algorithm: crypto.KeyAlgo_SCRYPT,
+		Hash:      key.Hash(),
+		Scrypt:    scryptConfig,
+	}
+	return env, nil
+}
+
+// decryptPrivateKey returns the private key of identity, decrypted with
+// password. Returns ErrIncorrectPassword if the password does not match.
+func decryptPrivateKey(identity *Identity, password []byte) ([]byte, error) {
+	env := &crypto.CryptoEnvelope{}
+	if err := proto.Unmarshal(identity.PrivateKey, env); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the private key of identity %s: %v", identity.Name, err)
+	}
+	if err := env.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid private key of identity %s: %v", identity.Name, err)
+	}
+
+	key, err := deriveUserKey(env.UserKey, password)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Decrypt(env, key, crypto.DecryptAESCTR, sha256.New)
+}
+
+// Identity returns the identity stored under name.
+func (v *Vault) Identity(name string) (*Identity, error) {
+	identities, err := v.Identities()
+	if err != nil {
+		return nil, err
+	}
+	for _, identity := range identities {
+		if identity.Name == name {
+			return identity, nil
+		}
+	}
+	return nil, fmt.Errorf("no identity named %s", name)
+}
+
+// Identities returns all identities in the vault, ordered by name.
+func (v *Vault) Identities() ([]*Identity, error) {
+	var identities []*Identity
+	err := v.view(func(tx Tx) error {
+		keys, err := tx.List(configBucketName, []byte(identityKeyPrefix))
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			val, err := tx.Get(configBucketName, k)
+			if err != nil {
+				return err
+			}
+			identity := &Identity{}
+			if err := proto.Unmarshal(val, identity); err != nil {
+				return fmt.Errorf("failed to unmarshal identity %s: %v",
+					strings.TrimPrefix(string(k), identityKeyPrefix), err)
+			}
+			identities = append(identities, identity)
+		}
+		return nil
+	})
+	return identities, err
+}
+
+// unlockWithIdentity returns the data key of cryptoEnv, unwrapped with the
+// private key of a stored identity that is one of its X25519 recipients. The
+// private key is decrypted with password. Returns ErrIncorrectPassword if no
+// such identity can be decrypted with password.
+func (v *Vault) unlockWithIdentity(cryptoEnv *crypto.CryptoEnvelope, password []byte) ([]byte, error) {
+	hasKeyRecipient := false
+	for _, r := range cryptoEnv.Recipients {
+		hasKeyRecipient = hasKeyRecipient || r.Type == crypto.RecipientType_X25519
+	}
+	if !hasKeyRecipient {
+		return nil, ErrIncorrectPassword
+	}
+
+	identities, err := v.Identities()
+	if err != nil {
+		return nil, err
+	}
+	for _, identity := range identities {
+		i := findKeyRecipient(cryptoEnv, identity.PublicKey)
+		if i < 0 {
+			continue
+		}
+		privateKey, err := decryptPrivateKey(identity, password)
+		if err == ErrIncorrectPassword {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		r := cryptoEnv.Recipients[i]
+		wrapKey, err := r.X25519WrapKey(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		return r.Unwrap(wrapKey, crypto.DecryptAESCTR, sha256.New)
+	}
+	return nil, ErrIncorrectPassword
+}
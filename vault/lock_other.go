@@ -0,0 +1,15 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package vault
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// lockFile is not supported on this platform.
+func lockFile(f *os.File, exclusive bool, timeout time.Duration) error {
+	return fmt.Errorf("the dir storage backend is not supported on this platform")
+}
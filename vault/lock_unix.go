@@ -0,0 +1,30 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package vault
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// lockFile takes an flock on f, exclusive or shared, waiting up to timeout
+// for other holders to release it. Returns errLocked on timeout.
+func lockFile(f *os.File, exclusive bool, timeout time.Duration) error {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		err := syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+		if err != syscall.EWOULDBLOCK {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return errLocked
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
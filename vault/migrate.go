@@ -0,0 +1,163 @@
+// This file implements versioning and upgrades of the database format.
+
+package vault
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// dbFormatVersion is the database format version written by this program.
+const dbFormatVersion = 1
+
+// versionKey is the key in the config bucket holding the format version.
+const versionKey = "version"
+
+// migrations holds the functions upgrading the database format, where the
+// function at index i upgrades from version i to i+1.
+var migrations = []func(tx Tx) error{
+	// Version 1 introduces the format version in the config bucket. The
+	// layout is unchanged otherwise.
+	func(tx Tx) error { return nil },
+}
+
+// openStore opens the store in either readwrite or readonly mode, waiting up
+// to timeout for its lock. The store is accessed through the agent if one is
+// running. Stores written by another version are refused with a *FormatError,
+// older ones have to be upgraded explicitly with Upgrade.
+func (v *Vault) openStore(readonly bool, timeout time.Duration) (Store, error) {
+	open := backends[v.backend]
+	if !v.opts.NoAgent && agentRunning(v.path) {
+		open = openAgentStore
+	}
+	store, err := open(v.path, readonly, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	version, err := storeVersion(store)
+	if err == nil && version != dbFormatVersion {
+		err = &FormatError{Version: version}
+	}
+	if err != nil {
+		_ = store.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Upgrade upgrades a database written by an older version to the current
+// format in a single transaction, after saving a backup next to it, e.g.
+// "vault.db.v0.bak". Returns false if the database is at the current version
+// already. As an agent keeps the database open, it must be stopped first.
+func (v *Vault) Upgrade() (upgraded bool, err error) {
+	if !v.opts.NoAgent && agentRunning(v.path) {
+		return false, fmt.Errorf("cannot upgrade %s while an agent is serving it", v.path)
+	}
+	if _, err := os.Stat(v.path); err != nil {
+		return false, err
+	}
+	store, err := backends[v.backend](v.path, false, v.opts.Timeout)
+	if err == errLocked {
+		err = &LockedError{Path: v.path, Timeout: v.opts.Timeout}
+	}
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if e := store.Close(); err == nil {
+			err = e
+		}
+	}()
+
+	version, err := storeVersion(store)
+	switch {
+	case err != nil:
+		return false, err
+	case version > dbFormatVersion:
+		return false, &FormatError{Version: version}
+	case version == dbFormatVersion:
+		return false, nil
+	}
+	return true, v.upgradeStore(store, version)
+}
+
+// storeVersion returns the format version of store. A store without any
+// buckets has not been written yet and is treated as the current version.
+func storeVersion(store Store) (version uint64, err error) {
+	err = store.View(func(tx Tx) error {
+		value, err := tx.Get(configBucketName, []byte(versionKey))
+		if err != nil {
+			return err
+		}
+		if value == nil {
+			buckets, err := tx.Buckets()
+			if err == nil && len(buckets) == 0 {
+				version = dbFormatVersion
+			}
+			return err // Otherwise written before versioning was introduced.
+		}
+		if len(value) != 8 {
+			return fmt.Errorf("invalid database format version")
+		}
+		version = binary.BigEndian.Uint64(value)
+		return nil
+	})
+	return version, err
+}
+
+// upgradeStore backs up store and upgrades it from format version to the
+// current version in a single transaction.
+func (v *Vault) upgradeStore(store Store, version uint64) error {
+	backupPath, err := v.backupStore(store, version)
+	if err != nil {
+		return fmt.Errorf("failed to back up the database before upgrading: %v", err)
+	}
+
+	err = store.Update(func(tx Tx) error {
+		for i := version; i < dbFormatVersion; i++ {
+			if err := migrations[i](tx); err != nil {
+				return fmt.Errorf("failed to upgrade the database to format version %d: %v", i+1, err)
+			}
+		}
+		return putDBVersion(tx)
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Upgraded the database format from version %d to %d, backup saved to %s",
+		version, dbFormatVersion, backupPath)
+	return nil
+}
+
+// backupStore copies store, of format version, to a new backup next to the
+// DB and returns its path. An existing backup is never overwritten, a later
+// one gets a timestamp in its name instead. Stores that can back themselves
+// up do so, all others are copied into a new store of the same backend.
+func (v *Vault) backupStore(store Store, version uint64) (string, error) {
+	path := fmt.Sprintf("%s.v%d.bak", v.path, version)
+	if _, err := os.Lstat(path); !os.IsNotExist(err) {
+		path = fmt.Sprintf("%s.v%d-%s.bak", v.path, version, time.Now().Format("20060102T150405"))
+		if _, err := os.Lstat(path); !os.IsNotExist(err) {
+			return "", fmt.Errorf("%s exists already", path)
+		}
+	}
+
+	if b, ok := store.(interface{ Backup(path string) error }); ok {
+		return path, b.Backup(path)
+	}
+	return path, store.View(func(src Tx) error {
+		return copyToNewStore(src, v.backend, path, v.opts.Timeout)
+	})
+}
+
+// putDBVersion stores the current format version in the config bucket.
+func putDBVersion(tx Tx) error {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, dbFormatVersion)
+	return tx.Put(configBucketName, []byte(versionKey), value)
+}
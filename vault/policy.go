@@ -0,0 +1,118 @@
+// This file implements the run policies of commands.
+
+package vault
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aleist/cmdsafe/crypto"
+	"github.com/golang/protobuf/proto"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Policy returns the run policy of the command stored under handle, see
+// Command.Policy, or nil if it has none. No password is needed, as a copy of
+// the policy is stored unencrypted. Run verifies the copy against the
+// encrypted policy.
+func (v *Vault) Policy(handle string) (*Policy, error) {
+	cryptoEnvMsg, err := v.loadCommandData([]byte(handle))
+	if err != nil {
+		return nil, err
+	}
+	cryptoEnv, err := unmarshalEnvelope(handle, cryptoEnvMsg)
+	if err != nil {
+		return nil, err
+	}
+	return envelopePolicy(handle, cryptoEnv)
+}
+
+// envelopePolicy returns the unencrypted copy of the run policy in cryptoEnv,
+// or nil if there is none.
+func envelopePolicy(handle string, cryptoEnv *crypto.CryptoEnvelope) (*Policy, error) {
+	if len(cryptoEnv.Policy) == 0 {
+		return nil, nil
+	}
+	policy := &Policy{}
+	if err := proto.Unmarshal(cryptoEnv.Policy, policy); err != nil {
+		return nil, &IntegrityError{Handle: handle,
+			Err: fmt.Errorf("failed to deserialise the run policy: %v", err)}
+	}
+	return policy, nil
+}
+
+// Validate checks that the allowed hours of p are well-formed. A nil policy is
+// valid.
+func (p *Policy) Validate() error {
+	if p.GetAllowHours() == "" {
+		return nil
+	}
+	_, _, err := parseHours(p.AllowHours)
+	return err
+}
+
+// check enforces p before the command stored under handle is run with opts at
+// time now. A nil policy allows all runs.
+func (p *Policy) check(handle string, opts *RunOptions, now time.Time) error {
+	if p == nil {
+		return nil
+	}
+
+	if p.AllowHours != "" {
+		from, to, err := parseHours(p.AllowHours)
+		if err != nil {
+			return &IntegrityError{Handle: handle, Err: err}
+		}
+		minute := now.Hour()*60 + now.Minute()
+		allowed := from <= minute && minute < to
+		if from > to { // The range spans midnight.
+			allowed = minute >= from || minute < to
+		}
+		if !allowed {
+			return &PolicyError{Handle: handle, Reason: "only allowed between " + p.AllowHours}
+		}
+	}
+	if p.RequireTty {
+		stdin := opts.Stdin
+		if stdin == nil {
+			stdin = os.Stdin
+		}
+		if f, ok := stdin.(*os.File); !ok || !terminal.IsTerminal(int(f.Fd())) {
+			return &PolicyError{Handle: handle, Reason: "stdin is not a terminal"}
+		}
+	}
+	if p.RequireReason && opts.Reason == "" {
+		return &PolicyError{Handle: handle, Reason: "a reason is required"}
+	}
+	if p.RequireConfirm && (opts.Confirm == nil || !opts.Confirm(handle)) {
+		return &PolicyError{Handle: handle, Reason: "not confirmed"}
+	}
+	return nil
+}
+
+// samePolicy reports whether a and b are equal, treating nil as the empty
+// policy.
+func samePolicy(a, b *Policy) bool {
+	if a == nil {
+		a = &Policy{}
+	}
+	if b == nil {
+		b = &Policy{}
+	}
+	return proto.Equal(a, b)
+}
+
+// parseHours parses a non-empty local time range of the form "HH:MM-HH:MM"
+// into minutes since midnight. The range spans midnight if from is after to.
+func parseHours(hours string) (from, to int, err error) {
+	var fromH, fromM, toH, toM int
+	_, _ = fmt.Sscanf(hours, "%d:%d-%d:%d", &fromH, &fromM, &toH, &toM)
+	from, to = fromH*60+fromM, toH*60+toM
+	if fmt.Sprintf("%02d:%02d-%02d:%02d", fromH, fromM, toH, toM) != hours || from == to ||
+		fromH < 0 || fromM < 0 || fromM > 59 || from >= 24*60 ||
+		toH < 0 || toM < 0 || toM > 59 || to > 24*60 {
+		return 0, 0, fmt.Errorf("invalid hours %q, want HH:MM-HH:MM", hours)
+	}
+	return from, to, nil
+}
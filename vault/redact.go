@@ -0,0 +1,115 @@
+// This file implements marking the secret values of commands and masking them
+// for display.
+
+package vault
+
+import (
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// RedactedValue replaces the secret values of a redacted command.
+const RedactedValue = "*****"
+
+// MarkSecretArg marks the argument at index i of c as a secret.
+func (c *Command) MarkSecretArg(i int) {
+	if !c.isSecretArg(i) {
+		c.SecretArgs = append(c.SecretArgs, uint32(i))
+	}
+}
+
+// MarkSecretEnv marks the environment variable name of c as a secret.
+func (c *Command) MarkSecretEnv(name string) {
+	if !c.isSecretEnv(name) {
+		c.SecretEnv = append(c.SecretEnv, name)
+	}
+}
+
+// MapSecretValues is like MapValues, but also marks each argument and
+// environment variable whose value fn changes as a secret.
+func (c *Command) MapSecretValues(fn func(value string) (string, error)) error {
+	for i, arg := range c.Args {
+		value, err := fn(arg)
+		if err != nil {
+			return err
+		}
+		if value != arg {
+			c.Args[i] = value
+			c.MarkSecretArg(i)
+		}
+	}
+	for name, env := range c.Env {
+		value, err := fn(env)
+		if err != nil {
+			return err
+		}
+		if value != env {
+			c.Env[name] = value
+			c.MarkSecretEnv(name)
+		}
+	}
+	return nil
+}
+
+// Redacted returns a copy of c with the values of its secret arguments and
+// environment variables, its access tokens and its TOTP seed replaced by
+// RedactedValue, so that it can be shown safely.
+func (c *Command) Redacted() *Command {
+	redacted := proto.Clone(c).(*Command)
+	for _, i := range c.SecretArgs {
+		if int(i) < len(redacted.Args) {
+			redacted.Args[i] = RedactedValue
+		}
+	}
+	for _, name := range c.SecretEnv {
+		if _, ok := redacted.Env[name]; ok {
+			redacted.Env[name] = RedactedValue
+		}
+	}
+	for scheme := range redacted.Tokens {
+		redacted.Tokens[scheme] = RedactedValue
+	}
+	if redacted.Totp != nil {
+		redacted.Totp.Secret = []byte(RedactedValue)
+	}
+	return redacted
+}
+
+// checkSecretMarks returns an error if a secret mark of cmdData refers to a
+// missing argument or environment variable.
+func checkSecretMarks(cmdData *Command) error {
+	for _, i := range cmdData.SecretArgs {
+		if int(i) >= len(cmdData.Args) {
+			return fmt.Errorf("%s has no argument %d to mark as secret", cmdData.Name, i+1)
+		}
+	}
+	for _, name := range cmdData.SecretEnv {
+		if _, ok := cmdData.Env[name]; !ok {
+			return fmt.Errorf("%s has no environment variable %s to mark as secret", cmdData.Name, name)
+		}
+	}
+	return nil
+}
+
+// isSecretArg reports whether the argument at index i of c is marked as a
+// secret.
+func (c *Command) isSecretArg(i int) bool {
+	for _, j := range c.SecretArgs {
+		if int(j) == i {
+			return true
+		}
+	}
+	return false
+}
+
+// isSecretEnv reports whether the environment variable name of c is marked as
+// a secret.
+func (c *Command) isSecretEnv(name string) bool {
+	for _, secret := range c.SecretEnv {
+		if secret == name {
+			return true
+		}
+	}
+	return false
+}
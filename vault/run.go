@@ -0,0 +1,247 @@
+// This file implements running stored commands.
+
+package vault
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// RunOptions configure Run. The zero value runs the command as saved, in the
+// foreground and connected to the standard streams of this process.
+type RunOptions struct {
+	Args     []string      // Additional arguments to the saved command.
+	Detached bool          // Return once the command has started.
+	Timeout  time.Duration // Terminate the command after this time if non-zero, ignored if detached.
+
+	// OnExpired is called with the expiry date of a command past it, see
+	// Command.Expires. If it returns an error, the command is not run and Run
+	// returns the error.
+	OnExpired func(expires time.Time) error
+
+	// Reason is why the command is run, required by Policy.RequireReason.
+	Reason string
+	// Confirm asks the user to confirm running the command stored under
+	// handle, required by Policy.RequireConfirm.
+	Confirm func(handle string) bool
+
+	Stdin  io.Reader // The command's stdin, os.Stdin if nil.
+	Stdout io.Writer // The command's stdout, os.Stdout if nil.
+	Stderr io.Writer // The command's stderr, os.Stderr if nil.
+}
+
+// Run runs the command stored under handle, decrypted with a password from the
+// password provider. Secret references and the {{totp}} placeholder are
+// resolved first. opts may be nil.
+//
+// Unless detached, Run waits for the command to exit, forwarding SIGINT and
+// SIGTERM to it, and returns its exit status in addition to any error.
+func (v *Vault) Run(handle string, opts *RunOptions) (status int, err error) {
+	if opts == nil {
+		opts = &RunOptions{}
+	}
+
+	// Enforce the policy before asking for a password.
+	policy, err := v.Policy(handle)
+	if err != nil {
+		return 1, err
+	}
+	if err := policy.check(handle, opts, time.Now()); err != nil {
+		return 1, err
+	}
+
+	cmdData, err := v.Get(handle)
+	if err != nil {
+		return 1, err
+	}
+	if !samePolicy(policy, cmdData.Policy) {
+		return 1, &IntegrityError{Handle: handle,
+			Err: fmt.Errorf("run policy mismatch, the database may have been tampered with")}
+	}
+	if err := checkExpiry(cmdData, opts); err != nil {
+		return 1, err
+	}
+
+	if err := resolveCommand(handle, cmdData, opts.Args); err != nil {
+		return 1, err
+	}
+
+	// Run the command.
+	cmd, input, err := newCmd(cmdData)
+	if err != nil {
+		return 1, fmt.Errorf("%s %v", handle, err)
+	}
+	if opts.Detached {
+		if e := startCmd(cmd, input); e != nil {
+			err = fmt.Errorf("failed to start: %v", e)
+		}
+	} else {
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if opts.Stdin != nil {
+			cmd.Stdin = opts.Stdin
+		}
+		if opts.Stdout != nil {
+			cmd.Stdout = opts.Stdout
+		}
+		if opts.Stderr != nil {
+			cmd.Stderr = opts.Stderr
+		}
+		status, err = runCmd(cmd, input, opts.Timeout)
+	}
+	if err != nil {
+		return status, fmt.Errorf("%s %v", handle, err)
+	}
+	return status, nil
+}
+
+// Resolve returns the command stored under handle as Run would run it,
+// decrypted with a password from the password provider: with its secret
+// references and the {{totp}} placeholder resolved and opts.Args appended. The
+// resolved values are marked as secrets, see Command.Redacted. As the command
+// is not run, neither its policy nor its expiry date are checked. opts may be
+// nil.
+func (v *Vault) Resolve(handle string, opts *RunOptions) (*Command, error) {
+	if opts == nil {
+		opts = &RunOptions{}
+	}
+	cmdData, err := v.Get(handle)
+	if err != nil {
+		return nil, err
+	}
+	if err := resolveCommand(handle, cmdData, opts.Args); err != nil {
+		return nil, err
+	}
+	return cmdData, nil
+}
+
+// resolveCommand resolves the secret references and the {{totp}} placeholder
+// in cmdData and appends the one-off arguments args to the saved ones.
+func resolveCommand(handle string, cmdData *Command, args []string) error {
+	// Resolve references to external secrets.
+	if err := resolveSecrets(cmdData); err != nil {
+		return fmt.Errorf("%s %v", handle, err)
+	}
+	if err := expandTOTP(cmdData, time.Now()); err != nil {
+		return fmt.Errorf("%s %v", handle, err)
+	}
+
+	// Append additional one-off arguments to the saved ones.
+	if len(args) > 0 {
+		cmdData.Args = append(cmdData.Args, args...)
+	}
+	return nil
+}
+
+// runCmd calls runCmdAsync and waits for the child process to complete. Listens
+// for interrupts SIGINT and SIGTERM and forwards them to the child. If timeout
+// is non-zero, the child is sent SIGTERM once it has passed.
+//
+// Attempts to return the process' exit status in addition to the error if any.
+func runCmd(cmd *exec.Cmd, input *shimInput, timeout time.Duration) (int, error) {
+	// Disable default behaviour and pass SIGINT and SIGTERM to child process.
+	interruptCh := make(chan os.Signal, 1)
+	signal.Notify(interruptCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interruptCh)
+
+	// Start the requested process.
+	exitCh, err := runCmdAsync(interruptCh, cmd, input)
+	if err != nil {
+		return 1, fmt.Errorf("failed to start: %v", err)
+	}
+
+	timedOut := make(chan struct{})
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			close(timedOut)
+			select {
+			case interruptCh <- syscall.SIGTERM:
+			default: // A signal is pending already.
+			}
+		})
+		defer timer.Stop()
+	}
+
+	status, err := waitCmd(exitCh)
+	select {
+	case <-timedOut:
+		err = fmt.Errorf("timed out after %v", timeout)
+	default:
+	}
+	return status, err
+}
+
+// waitCmd waits for the process started by runCmdAsync to exit.
+//
+// Attempts to return the process' exit status in addition to the error if any.
+func waitCmd(exitCh <-chan error) (int, error) {
+	var exitStatus int
+	err := <-exitCh
+	if err != nil {
+		// Try to determine the exit status of the child process.
+		exitStatus = 1 // Unknown reason.
+		if err, ok := err.(*exec.ExitError); ok {
+			if s, ok := err.Sys().(syscall.WaitStatus); ok {
+				exitStatus = s.ExitStatus()
+			}
+		}
+		err = fmt.Errorf("exited with error: %v", err)
+	}
+	return exitStatus, err
+}
+
+// runCmdAsync starts the process cmd, whose stdin, stdout and stderr must have
+// been set by the caller, passing it input, see startCmd. Returns once started,
+// not waiting for the child process to exit.
+//
+// signalCh can be used to send a signal to the child process.
+//
+// Returns an error if the process failed to be started. The error channel, on
+// the other hand, is closed when the child process has exited, first passing
+// any non-nil error returned by exec.Command.Wait.
+func runCmdAsync(signalCh <-chan os.Signal, cmd *exec.Cmd, input *shimInput) (<-chan error, error) {
+	// Start the process.
+	exitCh := make(chan error, 1)
+	err := startCmd(cmd, input)
+	if err != nil {
+		close(exitCh)
+		return exitCh, err
+	}
+
+	// Wait for it to exit.
+	waitCh := make(chan struct{})
+	go func() {
+		err := cmd.Wait()
+		if err != nil {
+			exitCh <- err
+		}
+		// Close exitCh to signal that the process has exited to the outside.
+		close(exitCh)
+		// And close waitCh to notify local listeners without them consuming the
+		// error value from exitCh.
+		close(waitCh)
+	}()
+
+	// Forward all signals to the child process.
+	go func() {
+		var done bool
+		for !done {
+			select {
+			case s := <-signalCh:
+				err := cmd.Process.Signal(s)
+				if err != nil {
+					log.Printf("Failed to forward signal to child process: %v", err)
+				}
+			case <-waitCh:
+				done = true
+			}
+		}
+	}()
+
+	return exitCh, nil
+}
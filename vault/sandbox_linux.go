@@ -0,0 +1,152 @@
+//go:build linux
+// +build linux
+
+package vault
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Seccomp filter return values and struct seccomp_data field offsets, see
+// linux/seccomp.h.
+const (
+	seccompRetAllow       = 0x7fff0000
+	seccompRetErrno       = 0x00050000
+	seccompDataNrOffset   = 0
+	seccompDataArchOffset = 4
+	seccompX32SyscallBit  = 0x40000000
+)
+
+// bpfJumpDeny is a placeholder jump offset resolved by installSeccompFilter.
+const bpfJumpDeny = 0xff
+
+// auditArch maps GOARCH to the AUDIT_ARCH_* value reported in seccomp_data.
+var auditArch = map[string]uint32{
+	"386":   0x40000003,
+	"amd64": 0xc000003e,
+	"arm":   0x40000028,
+	"arm64": 0xc00000b7,
+}
+
+// seccompDenied lists the syscalls that fail with EPERM under the seccomp
+// filter. They would allow a sandboxed process to read another's memory.
+var seccompDenied = []uintptr{
+	unix.SYS_PTRACE,
+	unix.SYS_PROCESS_VM_READV,
+	unix.SYS_PROCESS_VM_WRITEV,
+}
+
+// setSandboxAttr configures cmd, which must re-execute this program as the
+// exec shim, to start in new PID, mount and IPC namespaces. The shim applies
+// the remaining parts of the hardening profile with setupSandbox.
+//
+// Unprivileged users get a new user namespace in addition, mapping only their
+// own uid and gid, in which the shim is granted CAP_SYS_ADMIN to mount /proc.
+func setSandboxAttr(cmd *exec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: syscall.CLONE_NEWPID | syscall.CLONE_NEWNS | syscall.CLONE_NEWIPC,
+	}
+	if uid, gid := os.Getuid(), os.Getgid(); uid != 0 {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER
+		cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}}
+		cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}}
+		cmd.SysProcAttr.AmbientCaps = []uintptr{unix.CAP_SYS_ADMIN}
+	}
+	return nil
+}
+
+// setupSandbox must run in the first process of the namespaces set up by
+// setSandboxAttr. It remounts /proc with hidepid=2, drops the capabilities
+// granted for doing so, sets PR_SET_NO_NEW_PRIVS and optionally installs the
+// seccomp filter. All of these are inherited by child processes subsequently
+// started from the calling go-routine.
+func setupSandbox(profile *Sandbox) error {
+	// Capabilities, no_new_privs and seccomp filters are per thread and are
+	// inherited by children forked from it, so stay on the current thread.
+	runtime.LockOSThread()
+
+	// Do not propagate the new /proc mount to the parent namespace.
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("failed to make mounts private: %v", err)
+	}
+	if err := unix.Mount("proc", "/proc", "proc",
+		unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, "hidepid=2"); err != nil {
+		return fmt.Errorf("failed to mount /proc: %v", err)
+	}
+
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to drop ambient capabilities: %v", err)
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("failed to set no_new_privs: %v", err)
+	}
+	if profile.Seccomp {
+		return installSeccompFilter()
+	}
+	return nil
+}
+
+// installSeccompFilter installs a seccomp filter on the current thread that
+// makes the syscalls in seccompDenied fail with EPERM.
+func installSeccompFilter() error {
+	arch, ok := auditArch[runtime.GOARCH]
+	if !ok {
+		return fmt.Errorf("seccomp is not supported on %s", runtime.GOARCH)
+	}
+
+	// Deny everything that does not match the native architecture so the
+	// filter cannot be bypassed through a compat syscall ABI.
+	filter := []unix.SockFilter{
+		bpfStmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, seccompDataArchOffset),
+		bpfJump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, arch, 0, bpfJumpDeny),
+		bpfStmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, seccompDataNrOffset),
+	}
+	if runtime.GOARCH == "amd64" {
+		// The x32 ABI shares the x86-64 audit arch but sets this syscall bit.
+		filter = append(filter, bpfJump(unix.BPF_JMP|unix.BPF_JGE|unix.BPF_K,
+			seccompX32SyscallBit, bpfJumpDeny, 0))
+	}
+	for _, nr := range seccompDenied {
+		filter = append(filter, bpfJump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K,
+			uint32(nr), bpfJumpDeny, 0))
+	}
+	filter = append(filter,
+		bpfStmt(unix.BPF_RET|unix.BPF_K, seccompRetAllow),
+		bpfStmt(unix.BPF_RET|unix.BPF_K, seccompRetErrno|uint32(unix.EPERM)),
+	)
+
+	// Resolve the jumps to the final deny statement into relative offsets.
+	for i := range filter {
+		offset := uint8(len(filter) - i - 2)
+		if filter[i].Jt == bpfJumpDeny {
+			filter[i].Jt = offset
+		}
+		if filter[i].Jf == bpfJumpDeny {
+			filter[i].Jf = offset
+		}
+	}
+
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER,
+		uintptr(unsafe.Pointer(&prog)), 0, 0); err != nil {
+		return fmt.Errorf("failed to install the seccomp filter: %v", err)
+	}
+	return nil
+}
+
+// bpfStmt returns a BPF statement.
+func bpfStmt(code uint16, k uint32) unix.SockFilter {
+	return unix.SockFilter{Code: code, K: k}
+}
+
+// bpfJump returns a BPF conditional jump.
+func bpfJump(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+	return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package vault
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// setSandboxAttr is not supported on this platform.
+func setSandboxAttr(cmd *exec.Cmd) error {
+	return fmt.Errorf("sandboxing is only supported on Linux")
+}
+
+// setupSandbox is not supported on this platform.
+func setupSandbox(profile *Sandbox) error {
+	return fmt.Errorf("sandboxing is only supported on Linux")
+}
@@ -0,0 +1,336 @@
+// This file implements the resolution of references to secrets kept outside of
+// cmdsafe, which are resolved each time a command is run.
+
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// A SecretResolver resolves references to secrets kept in an external store.
+type SecretResolver interface {
+	// Resolve returns the secret ref refers to, which is the part of the
+	// reference following the scheme, e.g. "infra/db" for "pass:infra/db".
+	Resolve(ref string) (string, error)
+}
+
+// secretResolvers maps the schemes of secret references to the constructors
+// of their resolver. The constructors are passed the command data the
+// references belong to, for the access tokens stored with it.
+var secretResolvers = map[string]func(cmdData *Command) (SecretResolver, error){
+	"pass":  newPassResolver,
+	"file":  newSourceResolver("file"),
+	"cmd":   newSourceResolver("cmd"),
+	"vault": newVaultResolver,
+}
+
+// RegisterResolver makes the resolver returned by newResolver available for
+// references {{<scheme>:<ref>}}, replacing any registered for scheme before.
+// newResolver is called once per run with the command data the references
+// belong to, e.g. for the access tokens stored with it. It must be called
+// before the vault is used, typically in an init function.
+func RegisterResolver(scheme string, newResolver func(cmdData *Command) (SecretResolver, error)) {
+	secretResolvers[scheme] = newResolver
+}
+
+// HasResolver reports whether a resolver is registered for scheme.
+func HasResolver(scheme string) bool {
+	_, ok := secretResolvers[scheme]
+	return ok
+}
+
+// secretRefPattern matches a secret reference {{<scheme>:<ref>}} in an
+// argument or environment value.
+var secretRefPattern = regexp.MustCompile(`\{\{([a-z]+):([^}]+)\}\}`)
+
+// checkSecretRefs returns an error if cmdData contains a secret reference with
+// an unknown scheme.
+func checkSecretRefs(cmdData *Command) error {
+	return cmdData.MapValues(func(value string) (string, error) {
+		for _, m := range secretRefPattern.FindAllStringSubmatch(value, -1) {
+			if _, ok := secretResolvers[m[1]]; !ok {
+				return "", fmt.Errorf("unknown secret reference scheme %q in %s", m[1], m[0])
+			}
+		}
+		return value, nil
+	})
+}
+
+// resolveSecrets replaces the secret references in the arguments and
+// environment values of cmdData with the secrets they refer to, which are
+// marked as secrets.
+func resolveSecrets(cmdData *Command) error {
+	resolvers := map[string]SecretResolver{}
+	resolved := map[string]string{}
+
+	return cmdData.MapSecretValues(func(value string) (string, error) {
+		var err error
+		value = secretRefPattern.ReplaceAllStringFunc(value, func(m string) string {
+			if secret, ok := resolved[m]; ok || err != nil {
+				return secret
+			}
+
+			parts := secretRefPattern.FindStringSubmatch(m)
+			scheme, ref := parts[1], parts[2]
+			resolver, ok := resolvers[scheme]
+			if !ok {
+				newResolver, known := secretResolvers[scheme]
+				if !known {
+					err = fmt.Errorf("unknown secret reference scheme %q", scheme)
+					return ""
+				}
+				if resolver, err = newResolver(cmdData); err != nil {
+					return ""
+				}
+				resolvers[scheme] = resolver
+			}
+
+			secret, e := resolver.Resolve(ref)
+			if e != nil {
+				err = fmt.Errorf("failed to resolve %s: %v", m, e)
+				return ""
+			}
+			resolved[m] = secret
+			return secret
+		})
+		return value, err
+	})
+}
+
+// passResolver resolves references to pass entries, "pass:<entry>[#<field>]",
+// see ReadPassEntry. The field defaults to the password.
+type passResolver struct{}
+
+func newPassResolver(*Command) (SecretResolver, error) {
+	return &passResolver{}, nil
+}
+
+// Resolve implements SecretResolver.
+func (r *passResolver) Resolve(ref string) (string, error) {
+	name, field := splitSecretField(ref, "password")
+	fields, err := ReadPassEntry("", name)
+	if err != nil {
+		return "", err
+	}
+	value, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("the entry has no field %q", field)
+	}
+	return value, nil
+}
+
+// sourceResolver resolves references "file:<path>" and "cmd:<command>" to the
+// first line of the file or the command's output, see ReadSecretSource. A
+// leading ~/ in a path refers to the home directory.
+type sourceResolver struct {
+	kind string // Either "file" or "cmd".
+}
+
+func newSourceResolver(kind string) func(*Command) (SecretResolver, error) {
+	return func(*Command) (SecretResolver, error) {
+		return &sourceResolver{kind: kind}, nil
+	}
+}
+
+// Resolve implements SecretResolver.
+func (r *sourceResolver) Resolve(ref string) (string, error) {
+	if r.kind == "file" && strings.HasPrefix(ref, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		ref = filepath.Join(home, ref[2:])
+	}
+	secret, err := ReadSecretSource(r.kind + ":" + ref)
+	return string(secret), err
+}
+
+// vaultResolver resolves references "vault:<path>#<field>" to a field of a
+// secret in HashiCorp Vault, read with its HTTP API. Both versions of the KV
+// secrets engine are supported, for version 2 the path contains the "data"
+// segment, e.g. "secret/data/db#password".
+type vaultResolver struct {
+	addr   string       // The Vault server address, e.g. "https://vault:8200".
+	token  string       // The Vault access token.
+	client *http.Client // The client used for the API requests.
+}
+
+// defaultVaultAddr is the Vault server address if VAULT_ADDR is not set.
+const defaultVaultAddr = "https://127.0.0.1:8200"
+
+// newVaultResolver returns a vaultResolver for the server at $VAULT_ADDR. The
+// token is taken from the command data, or $VAULT_TOKEN or ~/.vault-token as
+// the Vault CLI does if the command has none.
+func newVaultResolver(cmdData *Command) (SecretResolver, error) {
+	addr := os.Getenv("VAULT_ADDR")
+	if addr == "" {
+		addr = defaultVaultAddr
+	}
+
+	token := cmdData.Tokens["vault"]
+	if token == "" {
+		token = os.Getenv("VAULT_TOKEN")
+	}
+	if token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			content, _ := ioutil.ReadFile(filepath.Join(home, ".vault-token"))
+			token = strings.TrimSpace(string(content))
+		}
+	}
+	if token == "" {
+		return nil, fmt.Errorf("no Vault token, save one with the command or set VAULT_TOKEN")
+	}
+
+	return &vaultResolver{
+		addr:   strings.TrimRight(addr, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Resolve implements SecretResolver.
+func (r *vaultResolver) Resolve(ref string) (string, error) {
+	path, field := splitSecretField(ref, "")
+	if field == "" {
+		return "", fmt.Errorf("missing field, want vault:<path>#<field>")
+	}
+
+	req, err := http.NewRequest(http.MethodGet, r.addr+"/v1/"+strings.TrimLeft(path, "/"), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", r.token)
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("vault returned %s", resp.Status)
+	}
+
+	var secret struct {
+		Data map[string]interface{} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("invalid vault response: %v", err)
+	}
+	data := secret.Data
+	if inner, ok := data["data"].(map[string]interface{}); ok && data["metadata"] != nil {
+		data = inner // KV version 2.
+	}
+
+	value, ok := data[field].(string)
+	if !ok {
+		return "", fmt.Errorf("the secret has no string field %q", field)
+	}
+	return value, nil
+}
+
+// splitSecretField splits ref of the form "<name>[#<field>]" into its parts,
+// using defaultField if there is no field.
+func splitSecretField(ref, defaultField string) (name, field string) {
+	if i := strings.LastIndex(ref, "#"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, defaultField
+}
+
+// ReadPassEntry returns the fields of the entry name in the pass password
+// store in dir, e.g. "servers/server1" for the gpg encrypted file
+// servers/server1.gpg. An empty dir selects $PASSWORD_STORE_DIR or
+// ~/.password-store as pass does.
+//
+// The first line of an entry is its "password" field, the following lines of
+// the form "key: value" are further fields with lower case names.
+func ReadPassEntry(dir, name string) (map[string]string, error) {
+	if dir == "" {
+		dir = os.Getenv("PASSWORD_STORE_DIR")
+	}
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("cannot determine the password store directory: %v", err)
+		}
+		dir = filepath.Join(home, ".password-store")
+	}
+
+	path := filepath.Join(dir, filepath.FromSlash(name)+".gpg")
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("no entry %s in the password store %s", name, dir)
+	}
+	cmd := exec.Command("gpg", "--quiet", "--decrypt", path)
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr // gpg may ask for the passphrase.
+	plaintext, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("gpg failed: %v", err)
+	}
+
+	fields := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(plaintext))
+	for first := true; scanner.Scan(); first = false {
+		line := scanner.Text()
+		if first {
+			fields["password"] = line
+			continue
+		}
+		if parts := strings.SplitN(line, ":", 2); len(parts) == 2 {
+			key := strings.ToLower(strings.TrimSpace(parts[0]))
+			if _, ok := fields[key]; !ok && key != "" {
+				fields[key] = strings.TrimSpace(parts[1])
+			}
+		}
+	}
+	return fields, scanner.Err()
+}
+
+// ReadSecretSource reads a secret from a non-interactive source, which is one
+// of:
+//
+//	env:NAME   the environment variable NAME,
+//	file:PATH  the first line of the file at PATH,
+//	cmd:CMD    the first line of the output of shell command CMD.
+func ReadSecretSource(source string) ([]byte, error) {
+	parts := strings.SplitN(source, ":", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid password source %q", source)
+	}
+	kind, arg := parts[0], parts[1]
+
+	var content []byte
+	var err error
+	switch kind {
+	case "env":
+		value, ok := os.LookupEnv(arg)
+		if !ok {
+			return nil, fmt.Errorf("password environment variable %s is not set", arg)
+		}
+		content = []byte(value)
+	case "file":
+		content, err = ioutil.ReadFile(arg)
+	case "cmd":
+		cmd := exec.Command("/bin/sh", "-c", arg)
+		cmd.Stderr = os.Stderr
+		content, err = cmd.Output()
+	default:
+		return nil, fmt.Errorf("invalid password source %q", source)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the password from %s: %v", kind, err)
+	}
+
+	line, _ := bufio.NewReader(bytes.NewReader(content)).ReadBytes('\n')
+	return bytes.TrimRight(line, "\r\n"), nil
+}
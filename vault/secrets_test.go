@@ -0,0 +1,101 @@
+package vault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newVaultStandIn returns a local HTTP stand-in for a Vault server holding a
+// KV version 1 secret at secret/db and a version 2 secret at kv/data/db, and a
+// resolver aimed at it with token.
+func newVaultStandIn(t *testing.T, token string) (*httptest.Server, *vaultResolver) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			http.Error(w, `{"errors":["method not allowed"]}`, http.StatusMethodNotAllowed)
+			return
+		}
+		if req.Header.Get("X-Vault-Token") != "s.valid" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		switch req.URL.Path {
+		case "/v1/secret/db":
+			_, _ = w.Write([]byte(`{"data":{"password":"v1-secret","port":5432}}`))
+		case "/v1/kv/data/db":
+			_, _ = w.Write([]byte(`{"data":{"data":{"password":"v2-secret"},"metadata":{"version":3}}}`))
+		case "/v1/secret/broken":
+			_, _ = w.Write([]byte(`{"data":`))
+		default:
+			http.Error(w, `{"errors":[]}`, http.StatusNotFound)
+		}
+	}))
+	return srv, &vaultResolver{addr: srv.URL, token: token, client: srv.Client()}
+}
+
+func TestVaultResolver(t *testing.T) {
+	srv, r := newVaultStandIn(t, "s.valid")
+	defer srv.Close()
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{ref: "secret/db#password", want: "v1-secret"},
+		{ref: "/secret/db#password", want: "v1-secret"},
+		{ref: "kv/data/db#password", want: "v2-secret"},
+		{ref: "secret/db#user", wantErr: `no string field "user"`},
+		{ref: "secret/db#port", wantErr: `no string field "port"`},
+		{ref: "kv/data/db#metadata", wantErr: `no string field "metadata"`},
+		{ref: "secret/db", wantErr: "missing field"},
+		{ref: "secret/missing#password", wantErr: "404 Not Found"},
+		{ref: "secret/broken#password", wantErr: "invalid vault response"},
+	}
+	for _, tt := range tests {
+		got, err := r.Resolve(tt.ref)
+		switch {
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("Resolve(%q) = %q, %v, want error containing %q", tt.ref, got, err, tt.wantErr)
+		case tt.wantErr == "" && (err != nil || got != tt.want):
+			t.Errorf("Resolve(%q) = %q, %v, want %q", tt.ref, got, err, tt.want)
+		}
+	}
+}
+
+func TestVaultResolverToken(t *testing.T) {
+	srv, r := newVaultStandIn(t, "s.other")
+	defer srv.Close()
+
+	if _, err := r.Resolve("secret/db#password"); err == nil || !strings.Contains(err.Error(), "403 Forbidden") {
+		t.Errorf("Resolve with a wrong token = %v, want a 403 Forbidden error", err)
+	}
+}
+
+func TestResolveSecretsVault(t *testing.T) {
+	srv, _ := newVaultStandIn(t, "")
+	defer srv.Close()
+	defer os.Setenv("VAULT_ADDR", os.Getenv("VAULT_ADDR"))
+	if err := os.Setenv("VAULT_ADDR", srv.URL+"/"); err != nil {
+		t.Fatal(err)
+	}
+
+	cmdData := &Command{
+		Executable: "psql",
+		Args:       []string{"-p", "{{vault:secret/db#password}}", "plain"},
+		Env:        map[string]string{"PGPASSWORD": "{{vault:kv/data/db#password}}"},
+		Tokens:     map[string]string{"vault": "s.valid"},
+	}
+	if err := resolveSecrets(cmdData); err != nil {
+		t.Fatalf("resolveSecrets: %v", err)
+	}
+	if cmdData.Args[1] != "v1-secret" || cmdData.Env["PGPASSWORD"] != "v2-secret" {
+		t.Errorf("resolved args %q and env %q, want the secrets", cmdData.Args, cmdData.Env)
+	}
+	if !cmdData.isSecretArg(1) || cmdData.isSecretArg(2) || !cmdData.isSecretEnv("PGPASSWORD") {
+		t.Errorf("secret marks %v and %v, want only the resolved values", cmdData.SecretArgs, cmdData.SecretEnv)
+	}
+}
@@ -0,0 +1,196 @@
+// This file implements sharing commands with additional recipients.
+
+package vault
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/aleist/cmdsafe/crypto"
+	"github.com/golang/protobuf/proto"
+)
+
+// AddPassword shares the command stored under handle with a new password,
+// which is asked from the password provider after a password of an existing
+// recipient. The data key is unwrapped with the latter and wrapped for the
+// new password, the encrypted command data remains unchanged.
+func (v *Vault) AddPassword(handle string) error {
+	pwd, err := v.password(handle, UnlockPassword)
+	if err != nil {
+		return err
+	}
+	stored, cryptoEnv, dataKey, err := v.unlockCommandEnvelope(handle, pwd)
+	if err != nil {
+		return err
+	}
+
+	newPwd, err := v.password(handle, AddedPassword)
+	if err != nil {
+		return err
+	}
+	// Only password recipients count, an identity with the same password is
+	// no reason to refuse.
+	if findPasswordRecipient(cryptoEnv, newPwd) >= 0 {
+		return fmt.Errorf("%s can already be decrypted with this password", handle)
+	}
+	recipient, err := v.newPasswordRecipient(dataKey, newPwd)
+	if err != nil {
+		return err
+	}
+	cryptoEnv.Recipients = append(cryptoEnv.Recipients, recipient)
+
+	return v.writeCommandEnvelope(handle, stored, cryptoEnv)
+}
+
+// AddPublicKey shares the command stored under handle with the owner of the
+// X25519 publicKey, authorised with the password of an existing recipient.
+func (v *Vault) AddPublicKey(handle string, publicKey []byte) error {
+	pwd, err := v.password(handle, UnlockPassword)
+	if err != nil {
+		return err
+	}
+	stored, cryptoEnv, dataKey, err := v.unlockCommandEnvelope(handle, pwd)
+	if err != nil {
+		return err
+	}
+
+	if findKeyRecipient(cryptoEnv, publicKey) >= 0 {
+		return fmt.Errorf("%s is already shared with this public key", handle)
+	}
+	recipient, err := crypto.NewX25519Recipient(dataKey, publicKey, crypto.EncryptAESCTR, sha256.New)
+	if err != nil {
+		return err
+	}
+	cryptoEnv.Recipients = append(cryptoEnv.Recipients, recipient)
+
+	return v.writeCommandEnvelope(handle, stored, cryptoEnv)
+}
+
+// RemovePassword removes the password recipient of the command stored under
+// handle whose password is asked from the password provider. The last
+// recipient cannot be removed.
+func (v *Vault) RemovePassword(handle string) error {
+	pwd, err := v.password(handle, RemovedPassword)
+	if err != nil {
+		return err
+	}
+	stored, cryptoEnv, _, err := v.unlockCommandEnvelope(handle, pwd)
+	if err != nil {
+		return err
+	}
+
+	// The password may have unlocked an identity rather than a password
+	// recipient.
+	i := findPasswordRecipient(cryptoEnv, pwd)
+	if i < 0 {
+		return ErrIncorrectPassword
+	}
+	return v.removeRecipient(handle, stored, cryptoEnv, i)
+}
+
+// RemovePublicKey removes the recipient with the X25519 publicKey from the
+// command stored under handle, authorised with the password of another
+// recipient. The last recipient cannot be removed.
+func (v *Vault) RemovePublicKey(handle string, publicKey []byte) error {
+	pwd, err := v.password(handle, UnlockPassword)
+	if err != nil {
+		return err
+	}
+	stored, cryptoEnv, _, err := v.unlockCommandEnvelope(handle, pwd)
+	if err != nil {
+		return err
+	}
+
+	i := findKeyRecipient(cryptoEnv, publicKey)
+	if i < 0 {
+		return fmt.Errorf("%s is not shared with this public key", handle)
+	}
+	return v.removeRecipient(handle, stored, cryptoEnv, i)
+}
+
+// removeRecipient removes the recipient at index i from cryptoEnv and replaces
+// the entry stored for handle with it, unless it is the last one.
+func (v *Vault) removeRecipient(handle string, stored []byte, cryptoEnv *crypto.CryptoEnvelope, i int) error {
+	if len(cryptoEnv.Recipients) == 1 {
+		return fmt.Errorf("cannot remove the last recipient of %s, delete it instead", handle)
+	}
+	cryptoEnv.Recipients = append(cryptoEnv.Recipients[:i], cryptoEnv.Recipients[i+1:]...)
+
+	return v.writeCommandEnvelope(handle, stored, cryptoEnv)
+}
+
+// unlockCommandEnvelope loads the crypto envelope stored under handle and
+// unwraps its data key with password. The command data is decrypted to verify
+// its integrity before the envelope is modified. Also returns the entry as
+// stored, see writeCommandEnvelope.
+func (v *Vault) unlockCommandEnvelope(handle string,
+		password []byte) (stored []byte, cryptoEnv *crypto.CryptoEnvelope, dataKey []byte, err error) {
+
+	stored, err = v.loadCommandData([]byte(handle))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cryptoEnv, err = unmarshalEnvelope(handle, stored)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	dataKey, err = v.unlockEnvelope(cryptoEnv, password)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if _, err := openCommandData(handle, cryptoEnv, dataKey); err != nil {
+		return nil, nil, nil, err
+	}
+	return stored, cryptoEnv, dataKey, nil
+}
+
+// writeCommandEnvelope serialises cryptoEnv and replaces the entry for handle
+// with it. The entry is checked to still be stored as it was loaded in the
+// same transaction, so that a concurrent change is not lost. Unlocking
+// happens before, as it may need to read the identities.
+func (v *Vault) writeCommandEnvelope(handle string, stored []byte, cryptoEnv *crypto.CryptoEnvelope) error {
+	cryptoEnvMsg, err := proto.Marshal(cryptoEnv)
+	if err != nil {
+		return fmt.Errorf("failed to serialise the crypto envelope: %v", err)
+	}
+	return v.update(func(tx Tx) error {
+		current, err := tx.Get(commandBucketName, []byte(handle))
+		if err != nil {
+			return err
+		}
+		if current == nil {
+			return &NotFoundError{Handle: handle}
+		}
+		if !bytes.Equal(current, stored) {
+			return fmt.Errorf("%s has been changed meanwhile, try again", handle)
+		}
+		return v.writeCommand([]byte(handle), cryptoEnvMsg, true)(tx)
+	})
+}
+
+// findPasswordRecipient returns the index of the recipient of cryptoEnv that
+// matches password, or -1 if there is none.
+func findPasswordRecipient(cryptoEnv *crypto.CryptoEnvelope, password []byte) int {
+	for i, r := range cryptoEnv.Recipients {
+		if r.Type != crypto.RecipientType_PASSWORD {
+			continue
+		}
+		if _, err := deriveUserKey(r.UserKey, password); err == nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// findKeyRecipient returns the index of the recipient of cryptoEnv with the
+// given X25519 public key, or -1 if there is none.
+func findKeyRecipient(cryptoEnv *crypto.CryptoEnvelope, publicKey []byte) int {
+	for i, r := range cryptoEnv.Recipients {
+		if r.Type == crypto.RecipientType_X25519 && bytes.Equal(r.PublicKey, publicKey) {
+			return i
+		}
+	}
+	return -1
+}
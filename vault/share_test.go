@@ -0,0 +1,84 @@
+package vault
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestShareVault returns a vault in a new temporary directory holding the
+// command server1 for the password "owner", and a function removing it. The
+// passwords are taken from passwords by purpose, onAdded is called when the
+// added password is asked for if not nil.
+func newTestShareVault(t *testing.T, passwords map[PasswordPurpose]string, onAdded *func()) (*Vault, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "cmdsafe-share")
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := PasswordFunc(func(req *PasswordRequest) ([]byte, error) {
+		if req.Purpose == AddedPassword && *onAdded != nil {
+			(*onAdded)()
+		}
+		return []byte(passwords[req.Purpose]), nil
+	})
+	v, err := Open(filepath.Join(dir, "vault.db"), provider, &Options{Timeout: time.Second})
+	if err == nil {
+		passwords[NewPassword] = "owner"
+		err = v.Save(&Command{Name: "server1", Executable: "ssh"}, false)
+	}
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return v, func() { _ = os.RemoveAll(dir) }
+}
+
+func TestAddPasswordOfIdentity(t *testing.T) {
+	passwords := map[PasswordPurpose]string{UnlockPassword: "owner"}
+	var onAdded func()
+	v, cleanup := newTestShareVault(t, passwords, &onAdded)
+	defer cleanup()
+
+	passwords[NewPassword] = "identity"
+	identity, err := v.NewIdentity("me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.AddPublicKey("server1", identity.PublicKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// The identity password unlocks the command, but is no password recipient.
+	passwords[AddedPassword] = "identity"
+	if err := v.AddPassword("server1"); err != nil {
+		t.Fatalf("AddPassword with the identity password: %v", err)
+	}
+	if err := v.AddPassword("server1"); err == nil || !strings.Contains(err.Error(), "already") {
+		t.Errorf("AddPassword of an existing recipient = %v, want an error", err)
+	}
+}
+
+func TestAddPasswordConcurrentSave(t *testing.T) {
+	passwords := map[PasswordPurpose]string{UnlockPassword: "owner", AddedPassword: "shared"}
+	var onAdded func()
+	v, cleanup := newTestShareVault(t, passwords, &onAdded)
+	defer cleanup()
+
+	// Another process replaces the command while the new password is entered.
+	onAdded = func() {
+		onAdded = nil
+		if err := v.Save(&Command{Name: "server1", Executable: "mosh"}, true); err != nil {
+			t.Errorf("Save: %v", err)
+		}
+	}
+	if err := v.AddPassword("server1"); err == nil || !strings.Contains(err.Error(), "changed meanwhile") {
+		t.Errorf("AddPassword during a concurrent save = %v, want an error", err)
+	}
+	if cmdData, err := v.Get("server1"); err != nil || cmdData.Executable != "mosh" {
+		t.Errorf("Get = %v, %v, want the concurrently saved command", cmdData, err)
+	}
+}
@@ -0,0 +1,178 @@
+// This file implements the exec shim, which receives a command over a pipe and
+// runs it with its hardening options applied.
+
+package vault
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// ShimCommand is the argument the executable is run with as the exec shim, see
+// ExecShim.
+const ShimCommand = "exec-shim"
+
+// shimFd is the file descriptor on which the exec shim receives the serialised
+// command data. It is the first entry of exec.Cmd.ExtraFiles.
+const shimFd = 3
+
+// shimInput is the serialised command data passed to the exec shim and the
+// write end of the pipe it is passed through.
+type shimInput struct {
+	msg []byte
+	w   *os.File
+}
+
+// newCmd returns the exec.Cmd used to run cmdData. Commands with a hardening
+// profile or argument scrubbing enabled are run through the exec shim, which
+// receives cmdData over a pipe so that it never appears in the shim's own
+// arguments or environment. The returned input, nil for commands run
+// directly, must be passed to startCmd.
+func newCmd(cmdData *Command) (*exec.Cmd, *shimInput, error) {
+	if cmdData.Sandbox == nil && cmdData.ArgScrub == nil {
+		return execCommand(cmdData), nil, nil
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to locate the exec shim: %v", err)
+	}
+	msg, err := proto.Marshal(cmdData)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to serialise the command data: %v", err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cmd := exec.Command(self, ShimCommand)
+	cmd.ExtraFiles = []*os.File{r}
+	if cmdData.Sandbox != nil {
+		if err := setSandboxAttr(cmd); err != nil {
+			_ = r.Close()
+			_ = w.Close()
+			return nil, nil, err
+		}
+	}
+	return cmd, &shimInput{msg: msg, w: w}, nil
+}
+
+// execCommand returns the exec.Cmd running cmdData directly, with its
+// environment variables added to those of this process.
+func execCommand(cmdData *Command) *exec.Cmd {
+	cmd := exec.Command(cmdData.Executable, cmdData.Args...)
+	if len(cmdData.Env) > 0 {
+		cmd.Env = append(os.Environ(), cmdData.Environ()...)
+	}
+	return cmd
+}
+
+// startCmd starts cmd and closes this process's copies of cmd.ExtraFiles,
+// which are owned by the child from then on. The command data in input, if
+// any, is written before startCmd returns, so that it reaches the exec shim
+// even if this process exits right away, as after a detached run. The write
+// fails rather than blocks if the shim exits without reading it, as the read
+// end is closed by then.
+func startCmd(cmd *exec.Cmd, input *shimInput) error {
+	err := cmd.Start()
+	for _, f := range cmd.ExtraFiles {
+		if e := f.Close(); err == nil && e != nil {
+			err = e
+		}
+	}
+	if input == nil {
+		return err
+	}
+
+	if err == nil {
+		if _, e := input.w.Write(input.msg); e != nil {
+			err = fmt.Errorf("failed to pass the command data to the exec shim: %v", e)
+		}
+	}
+	if e := input.w.Close(); err == nil && e != nil {
+		err = e
+	}
+	if err != nil && cmd.Process != nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}
+	return err
+}
+
+// ExecShim runs the exec shim. Programs using Run must call it when run with
+// ShimCommand as their first argument and exit with the returned status. It
+// reads the command data from shimFd, sets up the sandbox if requested, and
+// runs the command as its child, scrubbing its arguments if requested.
+//
+// Returns the child's exit status. Errors are only returned if the command
+// could not be started, the child's own failure is reported by the parent.
+func ExecShim() (int, error) {
+	cmdData, err := readShimCommand()
+	if err != nil {
+		return 1, err
+	}
+
+	if cmdData.Sandbox != nil {
+		if err := setupSandbox(cmdData.Sandbox); err != nil {
+			return 1, fmt.Errorf("sandbox: %v", err)
+		}
+	}
+
+	// Disable default behaviour and pass SIGINT and SIGTERM to child process.
+	interruptCh := make(chan os.Signal, 1)
+	signal.Notify(interruptCh, os.Interrupt, syscall.SIGTERM)
+
+	cmd := execCommand(cmdData)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	exitCh, err := runCmdAsync(interruptCh, cmd, nil)
+	if err != nil {
+		return 1, fmt.Errorf("failed to start: %v", err)
+	}
+
+	if cmdData.ArgScrub != nil {
+		// Prepare right away, the scrubber stays bound to this child even if it
+		// exits and its pid is reused.
+		scrub, err := newArgScrubber(cmd.Process.Pid, len(cmd.Args[0])+1)
+		if err != nil {
+			log.Printf("Warning: cannot scrub the command arguments: %v", err)
+		} else {
+			go func() {
+				time.Sleep(time.Duration(cmdData.ArgScrub.DelayMs) * time.Millisecond)
+				if err := scrub(); err != nil {
+					log.Printf("Warning: failed to scrub the command arguments: %v", err)
+				}
+			}()
+		}
+	}
+
+	status, _ := waitCmd(exitCh)
+	return status, nil
+}
+
+// readShimCommand reads and deserialises the command data from shimFd.
+func readShimCommand() (*Command, error) {
+	f := os.NewFile(shimFd, "shim")
+	if f == nil {
+		return nil, fmt.Errorf("no command data pipe")
+	}
+	defer f.Close()
+
+	msg, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the command data: %v", err)
+	}
+	cmdData := &Command{}
+	if err := proto.Unmarshal(msg, cmdData); err != nil {
+		return nil, fmt.Errorf("failed to deserialise the command data: %v", err)
+	}
+	return cmdData, nil
+}
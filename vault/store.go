@@ -0,0 +1,255 @@
+// This file implements the storage backend interface.
+
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A Store holds the data of a vault as key/value pairs grouped into named
+// buckets. All access happens in transactions.
+type Store interface {
+	// View calls fn with a read-only transaction.
+	View(fn func(tx Tx) error) error
+	// Update calls fn with a read-write transaction, which is committed if fn
+	// returns nil and rolled back otherwise.
+	Update(fn func(tx Tx) error) error
+	// Close releases the store and its lock.
+	Close() error
+}
+
+// A Tx is a transaction on a Store. Buckets are created by the first Put and
+// missing buckets are treated as empty.
+type Tx interface {
+	// Get returns the value of key in bucket, or nil if there is none. The
+	// value remains valid after the transaction.
+	Get(bucket string, key []byte) ([]byte, error)
+	// Put sets the value of key in bucket.
+	Put(bucket string, key, value []byte) error
+	// Delete removes key from bucket. Missing keys are ignored.
+	Delete(bucket string, key []byte) error
+	// List returns the keys in bucket starting with prefix in ascending byte
+	// order.
+	List(bucket string, prefix []byte) ([][]byte, error)
+	// Buckets returns the names of all non-empty buckets in ascending order.
+	Buckets() ([]string, error)
+}
+
+// Storage backends.
+const (
+	BoltBackend   = "bolt"   // A single bbolt file, the default.
+	DirBackend    = "dir"    // A directory of files, one per entry.
+	GitBackend    = "git"    // A directory of text files to keep in git, see gitStore.
+	SQLiteBackend = "sqlite" // A single SQLite file.
+)
+
+// backends maps the names of the storage backends to the functions opening a
+// store at path. Readonly stores allow concurrent readers. Both wait up to
+// timeout for the lock of the store and return errLocked if it is not
+// released in time. For SQLite this happens when a transaction begins.
+var backends = map[string]func(path string, readonly bool, timeout time.Duration) (Store, error){
+	BoltBackend:   openBoltStore,
+	DirBackend:    openDirStore,
+	GitBackend:    openGitStore,
+	SQLiteBackend: openSQLiteStore,
+}
+
+// Backends returns the names of the storage backends in ascending order.
+func Backends() []string {
+	names := make([]string, 0, len(backends))
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// errLocked is returned by the backends if the lock of the store cannot be
+// acquired in time.
+var errLocked = errors.New("the store is locked")
+
+// lockAttemptTimeout is how long each attempt to access a store waits for its
+// lock before Options.OnWait is called and the attempt repeated.
+const lockAttemptTimeout = time.Second
+
+// sqliteHeader starts every SQLite database file.
+var sqliteHeader = []byte("SQLite format 3\x00")
+
+// detectBackend returns the backend of the store at path. Existing stores are
+// recognised by their type: a directory is a git store if it has a manifest
+// and a dir store otherwise, and a file is either a SQLite or a bolt store. A
+// new store uses backend if not empty, otherwise SQLite for the extensions
+// .sqlite and .sqlite3 and bolt for all others.
+func detectBackend(path, backend string) (string, error) {
+	if info, err := os.Stat(path); err == nil {
+		if info.IsDir() {
+			if _, err := os.Stat(filepath.Join(path, gitManifestName)); err == nil {
+				return GitBackend, nil
+			}
+			return DirBackend, nil
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		header := make([]byte, len(sqliteHeader))
+		if _, err := io.ReadFull(f, header); err == nil && bytes.Equal(header, sqliteHeader) {
+			return SQLiteBackend, nil
+		}
+		return BoltBackend, nil
+	}
+
+	if backend != "" {
+		if _, ok := backends[backend]; !ok {
+			return "", fmt.Errorf("unknown storage backend %q, want one of %s", backend, strings.Join(Backends(), ", "))
+		}
+		return backend, nil
+	}
+	switch filepath.Ext(path) {
+	case ".sqlite", ".sqlite3":
+		return SQLiteBackend, nil
+	}
+	return BoltBackend, nil
+}
+
+// Backend returns the name of the storage backend of the vault.
+func (v *Vault) Backend() string {
+	return v.backend
+}
+
+// accessStore opens the store in either readwrite or readonly mode and passes
+// the instance to function fn. The store is closed and all resources released
+// when fn returns.
+//
+// While the store is locked by another process, access is retried until the
+// timeout of the vault, when a *LockedError is returned. fn must not have any
+// effect before its first access, as it may be called again if a transaction
+// cannot acquire the lock.
+//
+// The returned error may be from the store access or from fn, whichever
+// occurs first.
+func (v *Vault) accessStore(readonly bool, fn func(Store) error) error {
+	deadline := time.Now().Add(v.opts.Timeout)
+	notified := false
+	for {
+		timeout := time.Until(deadline)
+		if timeout <= 0 {
+			return &LockedError{Path: v.path, Timeout: v.opts.Timeout}
+		}
+		if timeout > lockAttemptTimeout {
+			timeout = lockAttemptTimeout
+		}
+
+		err := v.tryAccessStore(readonly, timeout, fn)
+		if err != errLocked {
+			return err
+		}
+		if !notified && v.opts.OnWait != nil {
+			v.opts.OnWait()
+			notified = true
+		}
+	}
+}
+
+// tryAccessStore implements a single attempt of accessStore, waiting up to
+// timeout for the lock.
+func (v *Vault) tryAccessStore(readonly bool, timeout time.Duration, fn func(Store) error) (err error) {
+	store, err := v.openStore(readonly, timeout)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if e := store.Close(); err == nil { // Return the first error encountered.
+			err = e
+		}
+	}()
+
+	return fn(store)
+}
+
+// view calls fn with a read-only transaction on the store.
+func (v *Vault) view(fn func(tx Tx) error) error {
+	return v.accessStore(true, func(store Store) error {
+		return store.View(fn)
+	})
+}
+
+// update calls fn with a read-write transaction on the store. A new store is
+// stamped with the current format version in the same transaction.
+func (v *Vault) update(fn func(tx Tx) error) error {
+	return v.accessStore(false, func(store Store) error {
+		return store.Update(func(tx Tx) error {
+			if err := fn(tx); err != nil {
+				return err
+			}
+			if version, err := tx.Get(configBucketName, []byte(versionKey)); err != nil || version != nil {
+				return err
+			}
+			return putDBVersion(tx)
+		})
+	})
+}
+
+// CopyTo copies all data of the vault into a new store of the given backend
+// at path, which must not exist yet. The vault itself is left unchanged.
+func (v *Vault) CopyTo(path, backend string) error {
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return fmt.Errorf("%s exists already", path)
+	}
+	if _, ok := backends[backend]; !ok {
+		return fmt.Errorf("unknown storage backend %q, want one of %s", backend, strings.Join(Backends(), ", "))
+	}
+
+	return v.view(func(src Tx) error {
+		return copyToNewStore(src, backend, path, v.opts.Timeout)
+	})
+}
+
+// copyToNewStore copies all buckets of src into a new store of backend at
+// path.
+func copyToNewStore(src Tx, backend, path string, timeout time.Duration) error {
+	dst, err := backends[backend](path, false, timeout)
+	if err != nil {
+		return err
+	}
+	err = dst.Update(func(dstTx Tx) error {
+		return copyTx(dstTx, src)
+	})
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// copyTx copies all buckets of src into dst.
+func copyTx(dst, src Tx) error {
+	buckets, err := src.Buckets()
+	if err != nil {
+		return err
+	}
+	for _, bucket := range buckets {
+		keys, err := src.List(bucket, nil)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			value, err := src.Get(bucket, key)
+			if err != nil {
+				return err
+			}
+			if err := dst.Put(bucket, key, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+// This file implements the bbolt storage backend.
+
+package vault
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltStore is a Store in a single bbolt file, where each bucket is a
+// top-level bolt bucket.
+type boltStore struct {
+	db *bolt.DB
+}
+
+func openBoltStore(path string, readonly bool, timeout time.Duration) (Store, error) {
+	before, err := os.Stat(path)
+	if readonly && err != nil {
+		// Opening a missing file would create it.
+		return nil, err
+	} else if !readonly {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{ReadOnly: readonly, Timeout: timeout})
+
+	// Compact may have replaced the file while waiting for its lock, and
+	// overwritten the old one. Try again with the new file.
+	if after, e := os.Stat(path); before != nil && e == nil && !os.SameFile(before, after) {
+		if err == nil {
+			_ = db.Close()
+		}
+		return nil, errLocked
+	}
+	if err == bolt.ErrTimeout {
+		return nil, errLocked
+	} else if err != nil {
+		return nil, err
+	}
+	return &boltStore{db: db}, nil
+}
+
+// View implements Store.
+func (s *boltStore) View(fn func(tx Tx) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+// Update implements Store.
+func (s *boltStore) Update(fn func(tx Tx) error) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return fn(boltTx{tx})
+	})
+}
+
+// Close implements Store.
+func (s *boltStore) Close() error {
+	return s.db.Close()
+}
+
+// Backup writes a consistent copy of the store to path.
+func (s *boltStore) Backup(path string) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.CopyFile(path, 0600)
+	})
+}
+
+// Compact implements Vault.Compact by copying all buckets into a fresh file,
+// which replaces the current one.
+func (s *boltStore) Compact(secure bool) error {
+	path := s.db.Path()
+	tmp := path + ".compact"
+	_ = os.Remove(tmp) // Left behind by an interrupted compaction.
+	dst, err := bolt.Open(tmp, 0600, nil)
+	if err != nil {
+		return err
+	}
+	err = s.View(func(src Tx) error {
+		return (&boltStore{db: dst}).Update(func(tx Tx) error {
+			return copyTx(tx, src)
+		})
+	})
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return replaceFile(path, tmp, secure)
+}
+
+// boltTx is a Tx on a boltStore.
+type boltTx struct {
+	tx *bolt.Tx
+}
+
+// Get implements Tx.
+func (t boltTx) Get(bucket string, key []byte) ([]byte, error) {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil, nil
+	}
+	value := b.Get(key)
+	if value == nil {
+		return nil, nil
+	}
+	// Values are only valid during the transaction.
+	return append([]byte{}, value...), nil
+}
+
+// Put implements Tx.
+func (t boltTx) Put(bucket string, key, value []byte) error {
+	b, err := t.tx.CreateBucketIfNotExists([]byte(bucket))
+	if err != nil {
+		return err
+	}
+	return b.Put(key, value)
+}
+
+// Delete implements Tx.
+func (t boltTx) Delete(bucket string, key []byte) error {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil
+	}
+	return b.Delete(key)
+}
+
+// List implements Tx.
+func (t boltTx) List(bucket string, prefix []byte) ([][]byte, error) {
+	b := t.tx.Bucket([]byte(bucket))
+	if b == nil {
+		return nil, nil
+	}
+
+	var keys [][]byte
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		keys = append(keys, append([]byte{}, k...))
+	}
+	return keys, nil
+}
+
+// Buckets implements Tx.
+func (t boltTx) Buckets() ([]string, error) {
+	var names []string
+	err := t.tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+		if k, _ := b.Cursor().First(); k != nil {
+			names = append(names, string(name))
+		}
+		return nil
+	})
+	return names, err
+}
@@ -0,0 +1,300 @@
+// This file implements the directory storage backend.
+
+package vault
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dirStore is a Store in a directory, which has a subdirectory per bucket
+// holding a file per key. Bucket and key names are encoded with encodeName.
+//
+// The directory is locked with flock, shared for readers. Each file is
+// replaced atomically when a transaction is committed, but a commit changing
+// several files can be interrupted part way.
+type dirStore struct {
+	dir      string
+	lock     *os.File // The directory, opened to hold the lock.
+	readonly bool
+}
+
+func openDirStore(path string, readonly bool, timeout time.Duration) (Store, error) {
+	if !readonly {
+		if err := os.MkdirAll(path, 0700); err != nil {
+			return nil, err
+		}
+	}
+	lock, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(lock, !readonly, timeout); err != nil {
+		_ = lock.Close()
+		return nil, err
+	}
+	return &dirStore{dir: path, lock: lock, readonly: readonly}, nil
+}
+
+// View implements Store.
+func (s *dirStore) View(fn func(tx Tx) error) error {
+	return fn(&dirTx{store: s})
+}
+
+// Update implements Store. Changes are kept in memory until fn returns.
+func (s *dirStore) Update(fn func(tx Tx) error) error {
+	if s.readonly {
+		return fmt.Errorf("cannot update a read-only store")
+	}
+	tx := &dirTx{store: s, pending: map[string]map[string][]byte{}}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+// Close implements Store.
+func (s *dirStore) Close() error {
+	return s.lock.Close() // Releases the lock.
+}
+
+// dirTx is a Tx on a dirStore.
+type dirTx struct {
+	store   *dirStore
+	pending map[string]map[string][]byte // Uncommitted values by bucket and key, nil if deleted.
+}
+
+// path returns the path of the file for key in bucket.
+func (t *dirTx) path(bucket string, key []byte) string {
+	return filepath.Join(t.store.dir, encodeName([]byte(bucket)), encodeName(key))
+}
+
+// Get implements Tx.
+func (t *dirTx) Get(bucket string, key []byte) ([]byte, error) {
+	if value, ok := t.pending[bucket][string(key)]; ok {
+		return value, nil
+	}
+	value, err := ioutil.ReadFile(t.path(bucket, key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return value, err
+}
+
+// Put implements Tx.
+func (t *dirTx) Put(bucket string, key, value []byte) error {
+	if t.pending == nil {
+		return fmt.Errorf("cannot write in a read-only transaction")
+	}
+	if t.pending[bucket] == nil {
+		t.pending[bucket] = map[string][]byte{}
+	}
+	t.pending[bucket][string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+// Delete implements Tx.
+func (t *dirTx) Delete(bucket string, key []byte) error {
+	if t.pending == nil {
+		return fmt.Errorf("cannot write in a read-only transaction")
+	}
+	if t.pending[bucket] == nil {
+		t.pending[bucket] = map[string][]byte{}
+	}
+	t.pending[bucket][string(key)] = nil
+	return nil
+}
+
+// List implements Tx.
+func (t *dirTx) List(bucket string, prefix []byte) ([][]byte, error) {
+	keys := map[string]bool{}
+	names, err := readDirNames(filepath.Join(t.store.dir, encodeName([]byte(bucket))))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		key, err := decodeName(name)
+		if err != nil {
+			return nil, err
+		}
+		keys[string(key)] = true
+	}
+	for key, value := range t.pending[bucket] {
+		keys[key] = value != nil
+	}
+
+	var list [][]byte
+	for key, exists := range keys {
+		if exists && strings.HasPrefix(key, string(prefix)) {
+			list = append(list, []byte(key))
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return bytes.Compare(list[i], list[j]) < 0 })
+	return list, nil
+}
+
+// Buckets implements Tx.
+func (t *dirTx) Buckets() ([]string, error) {
+	candidates := map[string]bool{}
+	names, err := readDirNames(t.store.dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		bucket, err := decodeName(name)
+		if err != nil {
+			return nil, err
+		}
+		candidates[string(bucket)] = true
+	}
+	for bucket := range t.pending {
+		candidates[bucket] = true
+	}
+
+	var buckets []string
+	for bucket := range candidates {
+		keys, err := t.List(bucket, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) > 0 {
+			buckets = append(buckets, bucket)
+		}
+	}
+	sort.Strings(buckets)
+	return buckets, nil
+}
+
+// commit writes the pending changes, each file atomically by renaming a
+// temporary file, and syncs the directories.
+func (t *dirTx) commit() error {
+	for bucket, values := range t.pending {
+		bucketDir := filepath.Join(t.store.dir, encodeName([]byte(bucket)))
+		if err := os.MkdirAll(bucketDir, 0700); err != nil {
+			return err
+		}
+		for key, value := range values {
+			path := t.path(bucket, []byte(key))
+			if value == nil {
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+				continue
+			}
+			if err := writeFileAtomic(path, value); err != nil {
+				return err
+			}
+		}
+		if err := syncDir(bucketDir); err != nil {
+			return err
+		}
+	}
+	return syncDir(t.store.dir)
+}
+
+// readDirNames returns the names in dir, skipping hidden files such as
+// temporary files. A missing dir is empty.
+func readDirNames(dir string) ([]string, error) {
+	f, err := os.Open(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	all, err := f.Readdirnames(-1)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, name := range all {
+		if !strings.HasPrefix(name, ".") {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// writeFileAtomic replaces the file at path with data by writing a temporary
+// file in the same directory and renaming it.
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0600)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+	}
+	return err
+}
+
+// syncDir flushes the directory entries of dir to disk.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// encodeName encodes name as a file name: lower-case letters, digits, '-', '_'
+// and '.' other than at the start are kept, all other bytes are written as %XX.
+// Upper-case letters are encoded too, so that names differing only in case
+// don't map to the same file on case-insensitive file systems.
+func encodeName(name []byte) string {
+	var b strings.Builder
+	for i, c := range name {
+		switch {
+		case 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.' && i > 0:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// decodeName reverses encodeName.
+func decodeName(name string) ([]byte, error) {
+	var decoded []byte
+	for i := 0; i < len(name); i++ {
+		if name[i] != '%' {
+			decoded = append(decoded, name[i])
+			continue
+		}
+		var c byte
+		if i+2 >= len(name) {
+			return nil, fmt.Errorf("invalid file name %q in the store", name)
+		}
+		if _, err := fmt.Sscanf(name[i+1:i+3], "%02X", &c); err != nil {
+			return nil, fmt.Errorf("invalid file name %q in the store", name)
+		}
+		decoded = append(decoded, c)
+		i += 2
+	}
+	return decoded, nil
+}
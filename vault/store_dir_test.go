@@ -0,0 +1,34 @@
+package vault
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEncodeName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"server1", "server1"},
+		{"web-01_a.b", "web-01_a.b"},
+		{".hidden", "%2Ehidden"},
+		{"Prod", "%50rod"},
+		{"a/b c", "a%2Fb%20c"},
+	}
+	for _, tt := range tests {
+		got := encodeName([]byte(tt.name))
+		if got != tt.want {
+			t.Errorf("encodeName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if decoded, err := decodeName(got); err != nil || string(decoded) != tt.name {
+			t.Errorf("decodeName(%q) = %q, %v, want %q", got, decoded, err, tt.name)
+		}
+	}
+
+	// Names differing only in case must not collide on case-insensitive file
+	// systems.
+	if strings.EqualFold(encodeName([]byte("Prod")), encodeName([]byte("prod"))) {
+		t.Errorf("encodeName maps Prod and prod to the same file name ignoring case")
+	}
+}
@@ -0,0 +1,453 @@
+// This file implements the git storage backend.
+
+package vault
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aleist/cmdsafe/crypto"
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+)
+
+// Layout of a git store.
+const (
+	gitManifestName = "manifest" // The format version and the list of entries.
+	gitEntriesDir   = "entries"  // The command entries, one file per handle.
+	gitEntrySuffix  = ".json"    // The suffix of the entry files.
+	gitLocalDir     = "local"    // All other buckets, in the layout of a dir store.
+)
+
+// gitAttributes makes git merge concurrent changes to the manifest by keeping
+// the lines of both sides.
+const gitAttributes = "# Written by cmdsafe, keeps the entries added on both sides of a merge.\n" +
+	gitManifestName + " merge=union\n"
+
+// gitIgnore keeps the data of the local user out of the repository.
+const gitIgnore = "# Written by cmdsafe, the audit log, identities and quarantine are per user.\n" +
+	"/" + gitLocalDir + "/\n"
+
+// gitStore is a Store in a directory meant to be kept in a git repository and
+// shared. Each command entry is a file holding its crypto envelope as JSON, so
+// that edits of different entries merge cleanly. The manifest lists the
+// entries and holds the format version. Edits of the same entry conflict, which
+// is detected and reported as a *ConflictError.
+//
+// The manifest is merged by keeping the lines of both sides, which can restore
+// the line of an entry deleted on one side. An entry is therefore deleted if
+// its file is, whether it is listed or not. A file of an entry that isn't
+// listed is left by git when the entry has been deleted on one side and edited
+// on the other, and is a conflict.
+//
+// All other buckets are per user and kept in a git-ignored directory. The
+// store is locked like a dir store.
+type gitStore struct {
+	dir      string
+	lock     *os.File // The directory, opened to hold the lock.
+	readonly bool
+}
+
+func openGitStore(path string, readonly bool, timeout time.Duration) (Store, error) {
+	if !readonly {
+		if err := os.MkdirAll(path, 0700); err != nil {
+			return nil, err
+		}
+	}
+	lock, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(lock, !readonly, timeout); err != nil {
+		_ = lock.Close()
+		return nil, err
+	}
+	return &gitStore{dir: path, lock: lock, readonly: readonly}, nil
+}
+
+// View implements Store.
+func (s *gitStore) View(fn func(tx Tx) error) error {
+	tx, err := s.begin(false)
+	if err != nil {
+		return err
+	}
+	return fn(tx)
+}
+
+// Update implements Store. Changes are kept in memory until fn returns.
+func (s *gitStore) Update(fn func(tx Tx) error) error {
+	if s.readonly {
+		return fmt.Errorf("cannot update a read-only store")
+	}
+	tx, err := s.begin(true)
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.commit()
+}
+
+// Close implements Store.
+func (s *gitStore) Close() error {
+	return s.lock.Close() // Releases the lock.
+}
+
+// begin starts a transaction, reading the manifest.
+func (s *gitStore) begin(writable bool) (*gitTx, error) {
+	manifest, err := readGitManifest(filepath.Join(s.dir, gitManifestName))
+	if err != nil {
+		return nil, err
+	}
+	tx := &gitTx{
+		store:    s,
+		local:    &dirTx{store: &dirStore{dir: filepath.Join(s.dir, gitLocalDir), readonly: s.readonly}},
+		manifest: manifest,
+	}
+	if writable {
+		tx.local.pending = map[string]map[string][]byte{}
+		tx.pending = map[string][]byte{}
+	}
+	return tx, nil
+}
+
+// gitTx is a Tx on a gitStore.
+type gitTx struct {
+	store    *gitStore
+	local    *dirTx // The buckets not under version control.
+	manifest *gitManifest
+	pending  map[string][]byte // Uncommitted entries by handle, nil if deleted.
+	changed  bool              // Whether the manifest has been changed.
+}
+
+// isVersion returns whether key in bucket is the format version, which is
+// kept in the manifest.
+func isVersion(bucket string, key []byte) bool {
+	return bucket == configBucketName && string(key) == versionKey
+}
+
+// entryPath returns the path of the file for the entry of handle.
+func (t *gitTx) entryPath(handle string) string {
+	return filepath.Join(t.store.dir, gitEntriesDir, encodeName([]byte(handle))+gitEntrySuffix)
+}
+
+// Get implements Tx. Entries with conflicting edits return a *ConflictError
+// and entries that cannot be decoded an *IntegrityError.
+func (t *gitTx) Get(bucket string, key []byte) ([]byte, error) {
+	switch {
+	case isVersion(bucket, key):
+		return t.manifest.version, nil
+	case bucket != commandBucketName:
+		return t.local.Get(bucket, key)
+	}
+
+	handle := string(key)
+	if value, ok := t.pending[handle]; ok {
+		return value, nil
+	}
+
+	data, err := ioutil.ReadFile(t.entryPath(handle))
+	switch {
+	case os.IsNotExist(err):
+		return nil, nil
+	case err != nil:
+		return nil, err
+	case !t.manifest.handles[handle]:
+		return nil, &ConflictError{Handle: handle, Reason: "its file exists, but is not listed in the manifest"}
+	case hasConflictMarkers(data):
+		return nil, &ConflictError{Handle: handle, Reason: "its file contains merge conflict markers"}
+	}
+
+	cryptoEnv := &crypto.CryptoEnvelope{}
+	if err := jsonpb.Unmarshal(bytes.NewReader(data), cryptoEnv); err != nil {
+		return nil, &IntegrityError{Handle: handle, Err: fmt.Errorf("failed to decode the entry file: %v", err)}
+	}
+	return proto.Marshal(cryptoEnv)
+}
+
+// Put implements Tx.
+func (t *gitTx) Put(bucket string, key, value []byte) error {
+	switch {
+	case t.pending == nil:
+		return fmt.Errorf("cannot write in a read-only transaction")
+	case isVersion(bucket, key):
+		if len(value) != 8 {
+			return fmt.Errorf("invalid database format version")
+		}
+		t.manifest.version = append([]byte{}, value...)
+		t.changed = true
+		return nil
+	case bucket != commandBucketName:
+		return t.local.Put(bucket, key, value)
+	}
+
+	t.pending[string(key)] = append([]byte{}, value...)
+	t.manifest.handles[string(key)] = true
+	t.changed = true
+	return nil
+}
+
+// Delete implements Tx.
+func (t *gitTx) Delete(bucket string, key []byte) error {
+	switch {
+	case t.pending == nil:
+		return fmt.Errorf("cannot write in a read-only transaction")
+	case isVersion(bucket, key):
+		t.manifest.version = nil
+		t.changed = true
+		return nil
+	case bucket != commandBucketName:
+		return t.local.Delete(bucket, key)
+	}
+
+	t.pending[string(key)] = nil
+	delete(t.manifest.handles, string(key))
+	t.changed = true
+	return nil
+}
+
+// List implements Tx. The entries are those having a file.
+func (t *gitTx) List(bucket string, prefix []byte) ([][]byte, error) {
+	if bucket == configBucketName {
+		keys, err := t.local.List(bucket, prefix)
+		if err == nil && t.manifest.version != nil && strings.HasPrefix(versionKey, string(prefix)) {
+			keys = append(keys, []byte(versionKey))
+			sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+		}
+		return keys, err
+	} else if bucket != commandBucketName {
+		return t.local.List(bucket, prefix)
+	}
+
+	handles := map[string]bool{}
+	names, err := readDirNames(filepath.Join(t.store.dir, gitEntriesDir))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if !strings.HasSuffix(name, gitEntrySuffix) {
+			continue
+		}
+		handle, err := decodeName(strings.TrimSuffix(name, gitEntrySuffix))
+		if err != nil {
+			return nil, err
+		}
+		handles[string(handle)] = true
+	}
+	for handle, value := range t.pending {
+		handles[handle] = value != nil
+	}
+
+	var keys [][]byte
+	for handle, exists := range handles {
+		if exists && strings.HasPrefix(handle, string(prefix)) {
+			keys = append(keys, []byte(handle))
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return bytes.Compare(keys[i], keys[j]) < 0 })
+	return keys, nil
+}
+
+// Buckets implements Tx.
+func (t *gitTx) Buckets() ([]string, error) {
+	buckets, err := t.local.Buckets()
+	if err != nil {
+		return nil, err
+	}
+	handles, err := t.List(commandBucketName, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(handles) > 0 {
+		buckets = append(buckets, commandBucketName)
+	}
+	if t.manifest.version != nil {
+		buckets = append(buckets, configBucketName)
+	}
+
+	// Remove the duplicate config bucket, if any.
+	sort.Strings(buckets)
+	var unique []string
+	for i, bucket := range buckets {
+		if i == 0 || bucket != buckets[i-1] {
+			unique = append(unique, bucket)
+		}
+	}
+	return unique, nil
+}
+
+// commit writes the pending entries, then the manifest and finally the local
+// buckets. The files of a new store that configure git are written with the
+// manifest.
+func (t *gitTx) commit() error {
+	// Encode all entries before writing any.
+	encoded := map[string][]byte{}
+	marshaler := &jsonpb.Marshaler{OrigName: true, Indent: "  "}
+	for handle, value := range t.pending {
+		if value == nil {
+			continue
+		}
+		cryptoEnv := &crypto.CryptoEnvelope{}
+		if err := proto.Unmarshal(value, cryptoEnv); err != nil {
+			return fmt.Errorf("failed to encode %s: %v", handle, err)
+		}
+		var buf bytes.Buffer
+		if err := marshaler.Marshal(&buf, cryptoEnv); err != nil {
+			return fmt.Errorf("failed to encode %s: %v", handle, err)
+		}
+		buf.WriteByte('\n')
+		encoded[handle] = buf.Bytes()
+	}
+
+	if len(t.pending) > 0 {
+		entriesDir := filepath.Join(t.store.dir, gitEntriesDir)
+		if err := os.MkdirAll(entriesDir, 0700); err != nil {
+			return err
+		}
+		for handle, value := range t.pending {
+			path := t.entryPath(handle)
+			if value == nil {
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+				continue
+			}
+			if err := writeFileAtomic(path, encoded[handle]); err != nil {
+				return err
+			}
+		}
+		if err := syncDir(entriesDir); err != nil {
+			return err
+		}
+	}
+
+	if t.changed {
+		// Drop the lines of deleted entries a merge restored.
+		for handle := range t.manifest.handles {
+			if _, ok := t.pending[handle]; ok {
+				continue
+			}
+			if _, err := os.Stat(t.entryPath(handle)); os.IsNotExist(err) {
+				delete(t.manifest.handles, handle)
+			}
+		}
+		for name, content := range map[string]string{".gitattributes": gitAttributes, ".gitignore": gitIgnore} {
+			path := filepath.Join(t.store.dir, name)
+			if _, err := os.Stat(path); os.IsNotExist(err) {
+				if err := writeFileAtomic(path, []byte(content)); err != nil {
+					return err
+				}
+			}
+		}
+		if err := writeFileAtomic(filepath.Join(t.store.dir, gitManifestName), t.manifest.encode()); err != nil {
+			return err
+		}
+		if err := syncDir(t.store.dir); err != nil {
+			return err
+		}
+	}
+
+	if len(t.local.pending) > 0 {
+		return t.local.commit()
+	}
+	return nil
+}
+
+// gitManifest is the content of the manifest of a git store.
+type gitManifest struct {
+	version []byte          // The format version as stored in the config bucket, nil if unset.
+	handles map[string]bool // The handles of the entries.
+}
+
+// readGitManifest reads the manifest at path. A missing manifest is empty.
+//
+// The manifest has a line "version <n>" and a line "entry <name>" per entry,
+// where name is the encoded handle as in the file name. Repeated lines, left
+// by merging the manifest of both sides, are accepted, as are lines of entries
+// without a file, see gitStore.
+func readGitManifest(path string) (*gitManifest, error) {
+	manifest := &gitManifest{handles: map[string]bool{}}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return manifest, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if hasConflictMarkers(data) {
+		return nil, fmt.Errorf("%s contains merge conflict markers, resolve them by keeping the lines of both sides", path)
+	}
+
+	var version uint64
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		fields := strings.Fields(line)
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case len(fields) == 2 && fields[0] == "version":
+			v, err := strconv.ParseUint(fields[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid version: %v", path, n, err)
+			}
+			if v > version {
+				version = v // The newer after a merge.
+			}
+		case len(fields) == 2 && fields[0] == "entry":
+			handle, err := decodeName(fields[1])
+			if err != nil {
+				return nil, fmt.Errorf("%s:%d: %v", path, n, err)
+			}
+			manifest.handles[string(handle)] = true
+		default:
+			return nil, fmt.Errorf("%s:%d: invalid line %q", path, n, line)
+		}
+	}
+	if version != 0 {
+		manifest.version = make([]byte, 8)
+		binary.BigEndian.PutUint64(manifest.version, version)
+	}
+	return manifest, scanner.Err()
+}
+
+// encode returns the manifest in its file format with the entries sorted, so
+// that changes merge cleanly.
+func (m *gitManifest) encode() []byte {
+	var names []string
+	for handle := range m.handles {
+		names = append(names, encodeName([]byte(handle)))
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.WriteString("# cmdsafe vault, see https://github.com/aleist/cmdsafe\n")
+	if m.version != nil {
+		fmt.Fprintf(&buf, "version %d\n", binary.BigEndian.Uint64(m.version))
+	}
+	for _, name := range names {
+		fmt.Fprintf(&buf, "entry %s\n", name)
+	}
+	return buf.Bytes()
+}
+
+// hasConflictMarkers returns whether data contains the markers git leaves in
+// files it failed to merge.
+func hasConflictMarkers(data []byte) bool {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if bytes.HasPrefix(line, []byte("<<<<<<< ")) || bytes.HasPrefix(line, []byte(">>>>>>> ")) ||
+			bytes.Equal(bytes.TrimSpace(line), []byte("=======")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,328 @@
+package vault
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aleist/cmdsafe/crypto"
+	"github.com/golang/protobuf/proto"
+)
+
+// newTestGitStore returns a git store in a new temporary directory holding
+// entries for handles, and a function removing it.
+func newTestGitStore(t *testing.T, handles ...string) (*gitStore, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "cmdsafe-git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := openGitStore(dir, false, time.Second)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	cleanup := func() {
+		_ = store.Close()
+		_ = os.RemoveAll(dir)
+	}
+
+	err = store.Update(func(tx Tx) error {
+		for _, handle := range handles {
+			value, err := proto.Marshal(&crypto.CryptoEnvelope{Data: []byte(handle)})
+			if err != nil {
+				return err
+			}
+			if err := tx.Put(commandBucketName, []byte(handle), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return store.(*gitStore), cleanup
+}
+
+// putEntry stores an envelope holding data as the entry of handle in s, or
+// deletes the entry if data is empty.
+func putEntry(s *gitStore, handle, data string) error {
+	return s.Update(func(tx Tx) error {
+		if data == "" {
+			return tx.Delete(commandBucketName, []byte(handle))
+		}
+		value, err := proto.Marshal(&crypto.CryptoEnvelope{Data: []byte(data)})
+		if err != nil {
+			return err
+		}
+		return tx.Put(commandBucketName, []byte(handle), value)
+	})
+}
+
+// getEntry returns the entry of handle in s.
+func getEntry(s *gitStore, handle string) (value []byte, err error) {
+	err = s.View(func(tx Tx) error {
+		value, err = tx.Get(commandBucketName, []byte(handle))
+		return err
+	})
+	return value, err
+}
+
+func TestGitStoreRoundTrip(t *testing.T) {
+	s, cleanup := newTestGitStore(t, "server1", "Server 2/prod")
+	defer cleanup()
+
+	for _, handle := range []string{"server1", "Server 2/prod"} {
+		value, err := getEntry(s, handle)
+		if err != nil {
+			t.Fatalf("Get(%q): %v", handle, err)
+		}
+		cryptoEnv := &crypto.CryptoEnvelope{}
+		if err := proto.Unmarshal(value, cryptoEnv); err != nil || string(cryptoEnv.Data) != handle {
+			t.Errorf("Get(%q) = %v, %v, want the saved envelope", handle, cryptoEnv, err)
+		}
+	}
+	if value, err := getEntry(s, "missing"); value != nil || err != nil {
+		t.Errorf("Get of a missing entry = %q, %v, want nil, nil", value, err)
+	}
+}
+
+func TestGitStoreConflicts(t *testing.T) {
+	tests := []struct {
+		name   string
+		edit   func(s *gitStore, entryPath string) error
+		reason string
+	}{
+		{
+			name: "added without the manifest",
+			edit: func(s *gitStore, entryPath string) error {
+				return ioutil.WriteFile(filepath.Join(s.dir, gitManifestName), []byte("version 1\n"), 0600)
+			},
+			reason: "not listed in the manifest",
+		},
+		{
+			name: "edited on both sides",
+			edit: func(s *gitStore, entryPath string) error {
+				data, err := ioutil.ReadFile(entryPath)
+				if err != nil {
+					return err
+				}
+				merged := "<<<<<<< HEAD\n" + string(data) + "=======\n" + string(data) + ">>>>>>> theirs\n"
+				return ioutil.WriteFile(entryPath, []byte(merged), 0600)
+			},
+			reason: "merge conflict markers",
+		},
+	}
+	for _, tt := range tests {
+		s, cleanup := newTestGitStore(t, "server1", "server2")
+		entryPath := (&gitTx{store: s}).entryPath("server1")
+		if err := tt.edit(s, entryPath); err != nil {
+			cleanup()
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		_, err := getEntry(s, "server1")
+		if e, ok := err.(*ConflictError); !ok || e.Handle != "server1" || !strings.Contains(e.Reason, tt.reason) {
+			t.Errorf("%s: Get = %v, want a *ConflictError for server1 containing %q", tt.name, err, tt.reason)
+		}
+		if _, err := getEntry(s, "server2"); err != nil && !strings.Contains(tt.reason, "manifest") {
+			t.Errorf("%s: Get of the other entry = %v, want no error", tt.name, err)
+		}
+		cleanup()
+	}
+}
+
+func TestGitManifestMerge(t *testing.T) {
+	s, cleanup := newTestGitStore(t, "server1")
+	defer cleanup()
+	path := filepath.Join(s.dir, gitManifestName)
+
+	// A union merge repeats the lines both sides have and keeps all others.
+	merged := "# comment\nversion 1\nentry server1\nversion 2\nentry server1\nentry server3\n"
+	if err := ioutil.WriteFile(path, []byte(merged), 0600); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := readGitManifest(path)
+	if err != nil {
+		t.Fatalf("readGitManifest: %v", err)
+	}
+	if len(manifest.handles) != 2 || !manifest.handles["server1"] || !manifest.handles["server3"] {
+		t.Errorf("merged manifest has the entries %v, want server1 and server3", manifest.handles)
+	}
+	if manifest.version[7] != 2 {
+		t.Errorf("merged manifest has the version %v, want the newer 2", manifest.version)
+	}
+
+	conflicted := "version 1\n<<<<<<< HEAD\nentry server1\n=======\nentry server3\n>>>>>>> theirs\n"
+	if err := ioutil.WriteFile(path, []byte(conflicted), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readGitManifest(path); err == nil || !strings.Contains(err.Error(), "merge conflict markers") {
+		t.Errorf("readGitManifest with conflict markers = %v, want an error", err)
+	}
+}
+
+// git runs git with args in dir, isolated from the user and system
+// configuration. Returns an error with the output if git fails.
+func git(dir string, args ...string) error {
+	cmd := exec.Command("git", append([]string{"-c", "user.name=cmdsafe", "-c", "user.email=cmdsafe@example.com",
+		"-c", "commit.gpgsign=false"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "GIT_CONFIG_GLOBAL="+os.DevNull, "HOME="+dir)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return nil
+}
+
+func TestGitStoreMerge(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	// Each side changes the entries a and b of the common base, mapping a
+	// handle to its new data or to "" to delete it.
+	tests := []struct {
+		name          string
+		ours, theirs  map[string]string
+		mergeFails    bool
+		want          map[string]string // The data of each entry after a clean merge.
+		conflict      string            // The entry that must be reported.
+		conflictCause string
+	}{
+		{
+			name:   "edits of different entries",
+			ours:   map[string]string{"a": "a2", "c": "c1"},
+			theirs: map[string]string{"b": "b2", "d": "d1"},
+			want:   map[string]string{"a": "a2", "b": "b2", "c": "c1", "d": "d1"},
+		},
+		{
+			name:   "deletes of different entries",
+			ours:   map[string]string{"a": ""},
+			theirs: map[string]string{"b": "", "c": "c1"},
+			want:   map[string]string{"c": "c1"},
+		},
+		{
+			name:          "edits of the same entry",
+			ours:          map[string]string{"a": "a2"},
+			theirs:        map[string]string{"a": "a3"},
+			mergeFails:    true,
+			conflict:      "a",
+			conflictCause: "merge conflict markers",
+		},
+		{
+			name:          "adds of the same entry",
+			ours:          map[string]string{"c": "c1"},
+			theirs:        map[string]string{"c": "c2"},
+			mergeFails:    true,
+			conflict:      "c",
+			conflictCause: "merge conflict markers",
+		},
+		{
+			name:          "delete and edit of the same entry",
+			ours:          map[string]string{"b": ""},
+			theirs:        map[string]string{"b": "b2"},
+			mergeFails:    true,
+			conflict:      "b",
+			conflictCause: "not listed in the manifest",
+		},
+		{
+			// The union merge of the manifest keeps the line of the deleted
+			// entry next to the added one.
+			name:   "delete next to an add in the manifest",
+			ours:   map[string]string{"b": ""},
+			theirs: map[string]string{"ba": "ba1"},
+			want:   map[string]string{"a": "a1", "ba": "ba1"},
+		},
+	}
+	for _, tt := range tests {
+		s, cleanup := newTestGitStore(t)
+		commit := func(side map[string]string, branch string) error {
+			for handle, data := range side {
+				if err := putEntry(s, handle, data); err != nil {
+					return err
+				}
+			}
+			if err := git(s.dir, "add", "-A"); err != nil {
+				return err
+			}
+			return git(s.dir, "commit", "-q", "-m", branch)
+		}
+
+		err := putEntry(s, "a", "a1")
+		if err == nil {
+			err = putEntry(s, "b", "b1")
+		}
+		if err == nil {
+			err = git(s.dir, "init", "-q")
+		}
+		if err == nil {
+			err = commit(nil, "base")
+		}
+		if err == nil {
+			err = git(s.dir, "checkout", "-q", "-b", "theirs")
+		}
+		if err == nil {
+			err = commit(tt.theirs, "theirs")
+		}
+		if err == nil {
+			err = git(s.dir, "checkout", "-q", "-")
+		}
+		if err == nil {
+			err = commit(tt.ours, "ours")
+		}
+		if err != nil {
+			cleanup()
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+
+		if err := git(s.dir, "merge", "-q", "--no-edit", "theirs"); (err != nil) != tt.mergeFails {
+			t.Errorf("%s: git merge = %v, want failure %v", tt.name, err, tt.mergeFails)
+		}
+		for handle, data := range tt.want {
+			value, err := getEntry(s, handle)
+			cryptoEnv := &crypto.CryptoEnvelope{}
+			if err == nil {
+				err = proto.Unmarshal(value, cryptoEnv)
+			}
+			if err != nil || string(cryptoEnv.Data) != data {
+				t.Errorf("%s: Get(%q) = %q, %v, want %q", tt.name, handle, cryptoEnv.Data, err, data)
+			}
+		}
+		if tt.want != nil {
+			err := s.View(func(tx Tx) error {
+				handles, err := tx.List(commandBucketName, nil)
+				if err == nil && len(handles) != len(tt.want) {
+					t.Errorf("%s: List = %q, want %d entries", tt.name, handles, len(tt.want))
+				}
+				return err
+			})
+			if err != nil {
+				t.Errorf("%s: List: %v", tt.name, err)
+			}
+
+			// The next change drops the lines of deleted entries.
+			if err := putEntry(s, "z", "z1"); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			manifest, err := readGitManifest(filepath.Join(s.dir, gitManifestName))
+			if err != nil || len(manifest.handles) != len(tt.want)+1 {
+				t.Errorf("%s: the manifest lists %v, %v, want the %d entries and z", tt.name, manifest.handles, err, len(tt.want))
+			}
+		}
+		if tt.conflict != "" {
+			_, err := getEntry(s, tt.conflict)
+			if e, ok := err.(*ConflictError); !ok || e.Handle != tt.conflict || !strings.Contains(e.Reason, tt.conflictCause) {
+				t.Errorf("%s: Get(%q) = %v, want a *ConflictError containing %q", tt.name, tt.conflict, err, tt.conflictCause)
+			}
+		}
+		cleanup()
+	}
+}
@@ -0,0 +1,181 @@
+// This file implements the SQLite storage backend.
+
+package vault
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // Registers the sqlite3 driver.
+)
+
+// sqliteSchema creates the single table holding all buckets.
+const sqliteSchema = `CREATE TABLE IF NOT EXISTS entries (
+	bucket TEXT NOT NULL,
+	key    BLOB NOT NULL,
+	value  BLOB NOT NULL,
+	PRIMARY KEY (bucket, key)
+)`
+
+// sqliteStore is a Store in a SQLite database file, with all buckets in the
+// entries table. Transactions of a store opened for writing take the database
+// lock when they begin.
+type sqliteStore struct {
+	db *sql.DB
+}
+
+func openSQLiteStore(path string, readonly bool, timeout time.Duration) (Store, error) {
+	params := url.Values{}
+	params.Set("_busy_timeout", fmt.Sprint(timeout.Nanoseconds()/int64(time.Millisecond)))
+	if readonly {
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+		params.Set("mode", "ro")
+	} else {
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return nil, err
+		}
+		// Create the file private to the owner, SQLite would apply the umask.
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		if err := f.Close(); err != nil {
+			return nil, err
+		}
+		params.Set("_txlock", "immediate")
+	}
+	dsn := (&url.URL{Scheme: "file", Opaque: url.PathEscape(path), RawQuery: params.Encode()}).String()
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(1)
+	if !readonly {
+		_, err = db.Exec(sqliteSchema)
+	} else {
+		err = db.Ping()
+	}
+	if err != nil {
+		_ = db.Close()
+		return nil, mapSQLiteLocked(err)
+	}
+	return &sqliteStore{db: db}, nil
+}
+
+// View implements Store. The read lock is taken by a first read, so that only
+// beginning the transaction can fail with errLocked.
+func (s *sqliteStore) View(fn func(tx Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return mapSQLiteLocked(err)
+	}
+	defer tx.Rollback()
+	var n int
+	if err := tx.QueryRow("SELECT count(*) FROM sqlite_master").Scan(&n); err != nil {
+		return mapSQLiteLocked(err)
+	}
+	return fn(sqliteTx{tx})
+}
+
+// Update implements Store.
+func (s *sqliteStore) Update(fn func(tx Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return mapSQLiteLocked(err)
+	}
+	if err := fn(sqliteTx{tx}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Close implements Store.
+func (s *sqliteStore) Close() error {
+	return s.db.Close()
+}
+
+// sqliteTx is a Tx on a sqliteStore.
+type sqliteTx struct {
+	tx *sql.Tx
+}
+
+// Get implements Tx.
+func (t sqliteTx) Get(bucket string, key []byte) ([]byte, error) {
+	var value []byte
+	err := t.tx.QueryRow("SELECT value FROM entries WHERE bucket = ? AND key = ?", bucket, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err == nil && value == nil {
+		value = []byte{}
+	}
+	return value, err
+}
+
+// Put implements Tx.
+func (t sqliteTx) Put(bucket string, key, value []byte) error {
+	if value == nil {
+		value = []byte{}
+	}
+	_, err := t.tx.Exec("INSERT OR REPLACE INTO entries (bucket, key, value) VALUES (?, ?, ?)", bucket, key, value)
+	return err
+}
+
+// Delete implements Tx.
+func (t sqliteTx) Delete(bucket string, key []byte) error {
+	_, err := t.tx.Exec("DELETE FROM entries WHERE bucket = ? AND key = ?", bucket, key)
+	return err
+}
+
+// List implements Tx. Blobs sort by their bytes in SQLite.
+func (t sqliteTx) List(bucket string, prefix []byte) ([][]byte, error) {
+	if prefix == nil {
+		prefix = []byte{} // NULL would not compare.
+	}
+	rows, err := t.tx.Query("SELECT key FROM entries WHERE bucket = ? AND key >= ? ORDER BY key", bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys [][]byte
+	for rows.Next() {
+		var key []byte
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Buckets implements Tx.
+func (t sqliteTx) Buckets() ([]string, error) {
+	rows, err := t.tx.Query("SELECT DISTINCT bucket FROM entries ORDER BY bucket")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var buckets []string
+	for rows.Next() {
+		var bucket string
+		if err := rows.Scan(&bucket); err != nil {
+			return nil, err
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, rows.Err()
+}
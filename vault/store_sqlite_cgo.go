@@ -0,0 +1,17 @@
+//go:build cgo
+// +build cgo
+
+package vault
+
+import (
+	"github.com/mattn/go-sqlite3"
+)
+
+// mapSQLiteLocked returns errLocked for the errors SQLite returns once the
+// busy timeout has passed, and err otherwise.
+func mapSQLiteLocked(err error) error {
+	if e, ok := err.(sqlite3.Error); ok && (e.Code == sqlite3.ErrBusy || e.Code == sqlite3.ErrLocked) {
+		return errLocked
+	}
+	return err
+}
@@ -0,0 +1,10 @@
+//go:build !cgo
+// +build !cgo
+
+package vault
+
+// mapSQLiteLocked returns err, the SQLite driver requires cgo and fails to
+// open any database without it.
+func mapSQLiteLocked(err error) error {
+	return err
+}
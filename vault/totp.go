@@ -0,0 +1,81 @@
+// This file implements TOTP codes and the {{totp}} placeholder.
+
+package vault
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+
+	"github.com/aleist/cmdsafe/crypto"
+)
+
+// TOTPPlaceholder is replaced with the current TOTP code when running a
+// command.
+const TOTPPlaceholder = "{{totp}}"
+
+// Default TOTP parameters, as used by most authenticator apps.
+const (
+	DefaultTOTPDigits = 6
+	DefaultTOTPPeriod = 30 * time.Second
+)
+
+// Code returns the TOTP code of seed at time t. Zero parameters select the
+// defaults.
+func (seed *Totp) Code(t time.Time) (string, error) {
+	var hashFn func() hash.Hash
+	switch seed.Algorithm {
+	case Totp_SHA1:
+		hashFn = sha1.New
+	case Totp_SHA256:
+		hashFn = sha256.New
+	case Totp_SHA512:
+		hashFn = sha512.New
+	default:
+		return "", fmt.Errorf("unsupported TOTP algorithm %v", seed.Algorithm)
+	}
+
+	digits, period := DefaultTOTPDigits, DefaultTOTPPeriod
+	if seed.Digits != 0 {
+		digits = int(seed.Digits)
+	}
+	if seed.Period != 0 {
+		period = time.Duration(seed.Period) * time.Second
+	}
+	return crypto.TOTP(seed.Secret, t, period, digits, hashFn)
+}
+
+// UsesTOTP reports whether an argument or environment value of c contains the
+// {{totp}} placeholder.
+func (c *Command) UsesTOTP() bool {
+	uses := false
+	_ = c.MapValues(func(value string) (string, error) {
+		uses = uses || strings.Contains(value, TOTPPlaceholder)
+		return value, nil
+	})
+	return uses
+}
+
+// expandTOTP replaces the {{totp}} placeholders in the arguments and
+// environment values of cmdData with its TOTP code at time t, which is marked
+// as a secret.
+func expandTOTP(cmdData *Command, t time.Time) error {
+	if !cmdData.UsesTOTP() {
+		return nil
+	}
+	if cmdData.Totp == nil {
+		return fmt.Errorf("has no TOTP seed for %s", TOTPPlaceholder)
+	}
+
+	code, err := cmdData.Totp.Code(t)
+	if err != nil {
+		return err
+	}
+	return cmdData.MapSecretValues(func(value string) (string, error) {
+		return strings.Replace(value, TOTPPlaceholder, code, -1), nil
+	})
+}
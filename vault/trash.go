@@ -0,0 +1,155 @@
+// This file implements the trash holding deleted commands.
+
+package vault
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Delete moves the command stored under handle into the trash, from where
+// Undelete restores it. A command deleted earlier under the same handle is
+// moved from the trash into the history. Returns a *NotFoundError if there is
+// no such command.
+func (v *Vault) Delete(handle string) error {
+	return v.update(func(tx Tx) error {
+		val, err := tx.Get(commandBucketName, []byte(handle))
+		if err != nil {
+			return err
+		} else if val == nil {
+			return &NotFoundError{Handle: handle}
+		}
+
+		if old, err := loadTrashed(tx, handle); err != nil {
+			return err
+		} else if old != nil {
+			if err := v.archiveRevision(tx, handle, old); err != nil {
+				return err
+			}
+		}
+		value, err := proto.Marshal(&Revision{Envelope: val, Time: time.Now().UnixNano(), Deleted: true})
+		if err != nil {
+			return fmt.Errorf("failed to serialise the deleted entry: %v", err)
+		}
+		if err := tx.Put(trashBucketName, []byte(handle), value); err != nil {
+			return err
+		}
+		return tx.Delete(commandBucketName, []byte(handle))
+	})
+}
+
+// Purge removes the command stored under handle together with its copy in the
+// trash and its history, so that nothing of it remains. Returns a
+// *NotFoundError if there is neither a command nor a deleted one.
+func (v *Vault) Purge(handle string) error {
+	return v.update(func(tx Tx) error {
+		val, err := tx.Get(commandBucketName, []byte(handle))
+		if err != nil {
+			return err
+		}
+		trashed, err := tx.Get(trashBucketName, []byte(handle))
+		if err != nil {
+			return err
+		}
+		if val == nil && trashed == nil {
+			return &NotFoundError{Handle: handle}
+		}
+
+		keys, err := tx.List(historyBucketName, historyPrefix(handle))
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if err := tx.Delete(historyBucketName, k); err != nil {
+				return err
+			}
+		}
+		if err := tx.Delete(trashBucketName, []byte(handle)); err != nil {
+			return err
+		}
+		return tx.Delete(commandBucketName, []byte(handle))
+	})
+}
+
+// Undelete moves the command deleted under handle back out of the trash.
+// Returns a *NotFoundError if there is no such deleted command and an
+// *ExistsError if a new command has been saved under handle since.
+func (v *Vault) Undelete(handle string) error {
+	return v.update(func(tx Tx) error {
+		trashed, err := loadTrashed(tx, handle)
+		if err != nil {
+			return err
+		} else if trashed == nil {
+			return &NotFoundError{Handle: handle}
+		}
+		if err := v.writeCommand([]byte(handle), trashed.Envelope, false)(tx); err != nil {
+			return err
+		}
+		return tx.Delete(trashBucketName, []byte(handle))
+	})
+}
+
+// Trash calls fn with the handle of each deleted command in the trash and the
+// time it was deleted, in ascending order of the handles.
+func (v *Vault) Trash(fn func(handle string, deleted time.Time)) error {
+	return v.view(func(tx Tx) error {
+		keys, err := tx.List(trashBucketName, nil)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			trashed, err := loadTrashed(tx, string(k))
+			if err != nil {
+				return err
+			}
+			fn(string(k), time.Unix(0, trashed.Time))
+		}
+		return nil
+	})
+}
+
+// EmptyTrash permanently removes the commands deleted more than olderThan ago
+// from the trash, all of them if olderThan is 0. Returns the handles of the
+// removed commands.
+func (v *Vault) EmptyTrash(olderThan time.Duration) ([]string, error) {
+	var removed []string
+	err := v.update(func(tx Tx) error {
+		removed = nil // The transaction may be repeated.
+		keys, err := tx.List(trashBucketName, nil)
+		if err != nil {
+			return err
+		}
+		cutoff := time.Now().Add(-olderThan)
+		for _, k := range keys {
+			trashed, err := loadTrashed(tx, string(k))
+			if err != nil {
+				return err
+			}
+			if olderThan > 0 && time.Unix(0, trashed.Time).After(cutoff) {
+				continue
+			}
+			if err := tx.Delete(trashBucketName, k); err != nil {
+				return err
+			}
+			removed = append(removed, string(k))
+		}
+		return nil
+	})
+	return removed, err
+}
+
+// loadTrashed loads the deleted command stored under handle in the trash, or
+// returns nil if there is none.
+func loadTrashed(tx Tx, handle string) (*Revision, error) {
+	value, err := tx.Get(trashBucketName, []byte(handle))
+	if err != nil || value == nil {
+		return nil, err
+	}
+	trashed := &Revision{}
+	if err := proto.Unmarshal(value, trashed); err != nil {
+		return nil, fmt.Errorf("%s: failed to deserialise the deleted entry: %v", handle, err)
+	}
+	return trashed, nil
+}
@@ -0,0 +1,185 @@
+// Package vault stores command configurations encrypted in a database and runs
+// them. It is the library behind the cmdsafe command line tool.
+//
+// A Vault is opened on the database, a bolt or SQLite file or a directory of
+// files, and asks a PasswordProvider for the passwords it needs:
+//
+//	v, err := vault.Open(path, vault.PasswordFunc(askPassword), nil)
+//	if err != nil {
+//		return err
+//	}
+//	status, err := v.Run("deploy", &vault.RunOptions{Args: []string{"--dry-run"}})
+//
+// Commands with a sandbox or argument scrubbing are run through the executable
+// itself, which must call ExecShim when its first argument is ShimCommand.
+package vault
+
+import (
+	"os"
+	"time"
+
+	"github.com/aleist/cmdsafe/crypto"
+)
+
+// Database constants.
+const (
+	configBucketName  = "config"  // The config bucket.
+	commandBucketName = "command" // The command data bucket.
+	auditBucketName   = "audit"   // The audit log bucket.
+
+	quarantineBucketName = "quarantine" // Broken command entries moved by Quarantine.
+	historyBucketName    = "history"    // Replaced and deleted command entries, see History.
+	trashBucketName      = "trash"      // Deleted command entries, see Delete.
+
+	defaultTimeout = 5 * time.Second // The default time to wait for the DB lock.
+)
+
+// Default scrypt parameters for new passwords, see
+// https://godoc.org/golang.org/x/crypto/scrypt
+const (
+	defaultScryptN = 16384
+	defaultScryptR = 8
+	defaultScryptP = 1
+)
+
+// Vault gives access to the commands stored in a database. The database is
+// only opened, and locked, for the duration of each operation, so several
+// processes may use the same vault.
+type Vault struct {
+	path      string
+	backend   string
+	passwords PasswordProvider
+	opts      Options
+}
+
+// Options configure a Vault. The zero value selects the defaults.
+type Options struct {
+	KDF     *KDFParams    // The key derivation for new passwords.
+	Timeout time.Duration // The time to wait for the DB lock, 5s if zero.
+	// OnWait is called, at most once per operation, if the DB is locked by
+	// another process and the vault keeps retrying. It may be nil.
+	OnWait func()
+	// NoAgent disables accessing the DB through a running agent, see
+	// ServeAgent.
+	NoAgent bool
+	// HistoryLimit is the number of revisions kept per command, 10 if zero
+	// and none if negative.
+	HistoryLimit int
+	// Backend is the storage backend of a new database, see Backends. An
+	// existing database always uses the backend it was created with.
+	Backend string
+}
+
+// KDFParams are the scrypt cost parameters for new passwords, see
+// crypto.NewScryptKey. Zero values select the defaults.
+type KDFParams struct {
+	N int64
+	R int32
+	P int32
+}
+
+// Validate returns an error if the parameters, with defaults applied, are not
+// accepted by scrypt.
+func (p *KDFParams) Validate() error {
+	config := p.scryptConfig(nil)
+	return crypto.ValidateScryptParams(config.N, config.R, config.P)
+}
+
+// scryptConfig returns the scrypt configuration for a new password with the
+// given salt, using the defaults for the parameters not set. p may be nil.
+func (p *KDFParams) scryptConfig(salt []byte) *crypto.ScryptConfig {
+	config := &crypto.ScryptConfig{Salt: salt, N: defaultScryptN, R: defaultScryptR, P: defaultScryptP}
+	if p != nil {
+		if p.N != 0 {
+			config.N = p.N
+		}
+		if p.R != 0 {
+			config.R = p.R
+		}
+		if p.P != 0 {
+			config.P = p.P
+		}
+	}
+	return config
+}
+
+// PasswordPurpose tells a PasswordProvider what a password is needed for.
+type PasswordPurpose int
+
+// Password purposes.
+const (
+	// UnlockPassword is a password the command or an identity is encrypted
+	// with.
+	UnlockPassword PasswordPurpose = iota
+	// NewPassword is the password a new command or identity is encrypted
+	// with. Providers asking a user should have it confirmed.
+	NewPassword
+	// AddedPassword is an additional password a command is shared with.
+	AddedPassword
+	// RemovedPassword is the password to remove from a command.
+	RemovedPassword
+)
+
+// PasswordRequest describes a password requested from a PasswordProvider.
+type PasswordRequest struct {
+	Handle  string // The command the password is for, empty for identities and Check.
+	Purpose PasswordPurpose
+}
+
+// A PasswordProvider supplies the passwords a Vault needs, e.g. by asking the
+// user on a terminal.
+type PasswordProvider interface {
+	Password(req *PasswordRequest) ([]byte, error)
+}
+
+// PasswordFunc adapts a function to the PasswordProvider interface.
+type PasswordFunc func(req *PasswordRequest) ([]byte, error)
+
+// Password implements PasswordProvider.
+func (f PasswordFunc) Password(req *PasswordRequest) ([]byte, error) {
+	return f(req)
+}
+
+// Open returns the vault stored in the database at path, which gets the
+// passwords it needs from passwords. opts may be nil for the defaults.
+//
+// The database is created on the first write. An existing database written by
+// a newer version is refused with a *FormatError. One written by an older
+// version is opened, but all access to it fails with a *FormatError until it
+// is upgraded with Upgrade.
+func Open(path string, passwords PasswordProvider, opts *Options) (*Vault, error) {
+	v := &Vault{path: path, passwords: passwords}
+	if opts != nil {
+		v.opts = *opts
+	}
+	if v.opts.Timeout == 0 {
+		v.opts.Timeout = defaultTimeout
+	}
+	backend, err := detectBackend(path, v.opts.Backend)
+	if err != nil {
+		return nil, err
+	}
+	v.backend = backend
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return v, nil
+	}
+	err = v.accessStore(true, func(Store) error { return nil })
+	if e, ok := err.(*FormatError); ok && e.Version < dbFormatVersion {
+		err = nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Path returns the path of the database.
+func (v *Vault) Path() string {
+	return v.path
+}
+
+// password asks the password provider for a password for handle.
+func (v *Vault) password(handle string, purpose PasswordPurpose) ([]byte, error) {
+	return v.passwords.Password(&PasswordRequest{Handle: handle, Purpose: purpose})
+}
@@ -0,0 +1,141 @@
+// This file implements the resolution of the DB path and subcommand 'where'.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Names used to locate the DB.
+const (
+	dbPathEnv         = "CMDSAFE_DB" // The environment variable overriding the DB path.
+	projectFileName   = ".cmdsafe"   // The file pointing to a per-project DB.
+	defaultDBFileName = "vault.db"   // The default DB file name.
+	legacyDBPath      = "data.db"    // The default DB path of earlier versions.
+)
+
+// dbSource describes where dbPath was taken from.
+var dbSource string
+
+// resolveDBPath sets dbPath and dbSource unless dbPath has been set by the -db
+// flag already. The path is taken from the first of these that is set:
+//
+//  1. the -db flag,
+//  2. the CMDSAFE_DB environment variable,
+//  3. a .cmdsafe file in the working directory or its closest parent having
+//     one, see readProjectFile,
+//  4. the db setting in the user configuration file,
+//  5. $XDG_DATA_HOME/cmdsafe/vault.db, where XDG_DATA_HOME defaults to
+//     $HOME/.local/share.
+//
+// If that default doesn't exist but data.db in the working directory does,
+// the default of earlier versions, data.db is used with a warning.
+func resolveDBPath() error {
+	if dbPath != "" {
+		dbSource = "-db flag"
+		return nil
+	}
+
+	if path := os.Getenv(dbPathEnv); path != "" {
+		dbPath, dbSource = path, dbPathEnv+" environment variable"
+		return nil
+	}
+
+	projectFile, err := findProjectFile()
+	if err != nil {
+		return err
+	}
+	if projectFile != "" {
+		if dbPath, err = readProjectFile(projectFile); err != nil {
+			return err
+		}
+		dbSource = "project file " + projectFile
+		return nil
+	}
+
+	if userCfg.DB != "" {
+		dbPath, dbSource = userCfg.DB, "config file"
+		return nil
+	}
+
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("cannot determine the default database path: %v", err)
+		}
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	dbPath = filepath.Join(dataHome, "cmdsafe", defaultDBFileName)
+	dbSource = "default location in $XDG_DATA_HOME"
+	if _, err := os.Stat(dbPath); os.IsNotExist(err) {
+		if info, err := os.Stat(legacyDBPath); err == nil && !info.IsDir() {
+			log.Printf("Warning: using %s in the working directory, the default of earlier versions. "+
+				"Move it to %s, or select it with -db or `%s config set db`", legacyDBPath, dbPath, progName)
+			dbPath, dbSource = legacyDBPath, "earlier default in the working directory"
+		}
+	}
+	return nil
+}
+
+// findProjectFile walks up from the working directory and returns the path of
+// the first .cmdsafe file found, or an empty string if there is none.
+func findProjectFile() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		path := filepath.Join(dir, projectFileName)
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return path, nil
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// readProjectFile returns the DB path configured in the .cmdsafe file at path.
+// The file contains the DB path on its first line, relative paths are resolved
+// against the directory of the file. An empty file refers to vault.db in that
+// directory.
+func readProjectFile(path string) (string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	dbFile := strings.TrimSpace(strings.SplitN(string(content), "\n", 2)[0])
+	if dbFile == "" {
+		dbFile = defaultDBFileName
+	}
+	if !filepath.IsAbs(dbFile) {
+		dbFile = filepath.Join(filepath.Dir(path), dbFile)
+	}
+	return dbFile, nil
+}
+
+// doCmdWhere executes subcommand 'where', printing the DB path in use and
+// where it was taken from.
+func doCmdWhere() error {
+	_, err := os.Stat(dbPath)
+	exists := !os.IsNotExist(err)
+
+	return printOutput(map[string]interface{}{"path": dbPath, "source": dbSource, "exists": exists}, func() {
+		fmt.Println(dbPath)
+		fmt.Println("  from", dbSource)
+		if !exists {
+			fmt.Println("  (does not exist yet)")
+		}
+	})
+}